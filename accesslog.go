@@ -0,0 +1,146 @@
+package civet
+
+import (
+	"context"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/tlog"
+	"github.com/YCloud/civet/trace"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// accessLogger 每个请求一行的访问日志，与应用日志分开写入 AccessLogConf 配置的文件
+type accessLogger struct {
+	cfg    *config.AccessLogConf
+	logger tlog.Logger
+	closer io.Closer
+}
+
+// newAccessLogger 未配置 AccessLog 时返回 nil
+func newAccessLogger(servant string, cfg *config.AccessLogConf) (*accessLogger, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	enc, err := newLogEncoder(cfg.Encoder)
+	if err != nil {
+		return nil, err
+	}
+	interval, err := tlog.ParseRotateInterval(cfg.Rotate)
+	if err != nil {
+		return nil, err
+	}
+	rw, err := tlog.NewRotateWriter(tlog.RotateConfig{
+		Dir:        cfg.LogPath,
+		Name:       cfg.LogName,
+		MaxSize:    int64(cfg.MaxSize) << 20,
+		MaxBackups: cfg.MaxBackups,
+		MaxAge:     cfg.MaxAge,
+		Interval:   interval,
+	})
+	if err != nil {
+		return nil, err
+	}
+	w := tlog.NewAsyncWriter(rw, cfg.QueueSize, tlog.Drop_Newest)
+	return &accessLogger{
+		cfg: cfg,
+		logger: tlog.NewLogger(
+			tlog.WithEncoder(enc),
+			tlog.WithWriter(w),
+			tlog.WithFields(tlog.Any("servant", servant)),
+		),
+		closer: w,
+	}, nil
+}
+
+// sampled 慢请求总是记录，其他请求按 SampleRate 采样
+func (l *accessLogger) sampled(latency time.Duration) bool {
+	if l.cfg.SlowThreshold > 0 && latency >= l.cfg.SlowThreshold {
+		return true
+	}
+	return l.cfg.SampleRate >= 1 || rand.Float64() < l.cfg.SampleRate
+}
+
+func (l *accessLogger) log(rec *accessRecord) {
+	if l == nil {
+		return
+	}
+	latency := time.Since(rec.start)
+	if !l.sampled(latency) {
+		return
+	}
+	l.logger.Log(context.Background(), tlog.INFO, "access",
+		tlog.Any("remote", rec.remote),
+		tlog.Any("route", rec.route),
+		tlog.Any("content_type", rec.contentType),
+		tlog.Any("req_size", rec.reqSize),
+		tlog.Any("resp_size", rec.respSize),
+		tlog.Any("code", rec.code),
+		tlog.Any("code_desc", rec.codeDesc),
+		tlog.Any("latency", latency),
+		tlog.Any("trace_id", rec.getTraceID()),
+	)
+}
+
+func (l *accessLogger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+type accessRecordKey struct{}
+
+// accessRecord 一个请求的访问日志，trace_id 在 trace 拦截器创建 span 后填入
+type accessRecord struct {
+	start       time.Time
+	remote      string
+	route       string
+	contentType string
+	reqSize     int64
+	respSize    int64
+	code        int32
+	codeDesc    string
+
+	// 超时返回时处理请求的协程可能仍在运行，traceID 需要加锁
+	mu      sync.Mutex
+	traceID trace.TraceID
+}
+
+// newAccessRecord 先使用上游的 trace id，请求未进入拦截器时也能记录
+func newAccessRecord(remote, route, contentType, traceparent string) *accessRecord {
+	rec := &accessRecord{
+		start:       time.Now(),
+		remote:      remote,
+		route:       route,
+		contentType: contentType,
+	}
+	if sc, ok := trace.ParseTraceparent(traceparent, ""); ok {
+		rec.traceID = sc.TraceID
+	}
+	return rec
+}
+
+func (rec *accessRecord) setTraceID(id trace.TraceID) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.traceID = id
+}
+
+func (rec *accessRecord) getTraceID() trace.TraceID {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.traceID
+}
+
+func withAccessRecord(ctx context.Context, rec *accessRecord) context.Context {
+	return context.WithValue(ctx, accessRecordKey{}, rec)
+}
+
+// setAccessTraceID 由 trace 拦截器调用，记录本次请求的 trace id
+func setAccessTraceID(ctx context.Context, span *trace.Span) {
+	if rec, ok := ctx.Value(accessRecordKey{}).(*accessRecord); ok {
+		rec.setTraceID(span.TraceID)
+	}
+}
@@ -0,0 +1,319 @@
+package civet
+
+import (
+	"encoding/json"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/metrics"
+	"github.com/YCloud/civet/tlog"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"sort"
+	"time"
+)
+
+// initAdmin 配置了 admin 时添加管理接口 servant，随其他 servant 一起启动与停止
+func initAdmin() {
+	cfg := config.GetConfig().Admin
+	if cfg == nil {
+		return
+	}
+	app.admin = newHttpServerWithConf(config.AdminServantName, cfg.ServantConf(), newAdminHandler())
+	addServant(app.admin)
+}
+
+func newAdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", adminIndex)
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/servants", adminServants)
+	mux.HandleFunc("/conns", adminConns)
+	mux.HandleFunc("/clients", adminClients)
+	mux.HandleFunc("/config", adminConfig)
+	mux.HandleFunc("/loglevel", adminLogLevel)
+	mux.HandleFunc("/drain", adminDrain)
+	mux.HandleFunc("/reload", adminReload)
+	mux.HandleFunc("/ratelimit", adminRateLimit)
+
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+const adminUsage = `GET  /metrics                  prometheus metrics
+GET  /servants                 servants with endpoint and status
+GET  /conns?servant=NAME       connections of rpc servants
+GET  /clients                  clients with endpoints, pool connections and circuit breakers
+GET  /config                   current config with secrets redacted
+GET  /loglevel                 current log level
+POST /loglevel?level=LEVEL     set log level: debug, info, warn, error
+POST /drain?servant=NAME       deregister and stop a servant
+POST /reload                   reload config file
+GET  /ratelimit?servant=NAME   rate limit rules of a servant (yaml)
+POST /ratelimit?servant=NAME   replace rate limit rules with the yaml body, empty body disables
+GET  /debug/pprof/             pprof
+`
+
+func adminIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(adminUsage))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// requirePost 修改状态的命令只接受 POST
+func requirePost(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return false
+	}
+	return true
+}
+
+type servantInfo struct {
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	Endpoint *Endpoint `json:"endpoint"`
+	Status   string    `json:"status"`
+	Conns    int       `json:"conns,omitempty"`
+	Requests int32     `json:"requests,omitempty"`
+	Streams  int32     `json:"streams,omitempty"`
+}
+
+func adminServants(w http.ResponseWriter, r *http.Request) {
+	list := make([]*servantInfo, 0, len(app.servantList))
+	for _, srv := range app.servantList {
+		info := &servantInfo{
+			Name:     srv.Name(),
+			Endpoint: srv.Endpoint(),
+			Status:   "running",
+		}
+		switch s := srv.(type) {
+		case *rpcServer:
+			info.Type = "rpc"
+			info.Conns = len(s.getConns())
+			info.Requests = s.reqNum.Load()
+			info.Streams = s.streamNum.Load()
+			if s.isShutdown.Load() {
+				info.Status = "stopped"
+			}
+		case *httpServer:
+			info.Type = "http"
+			if s.isShutdown.Load() {
+				info.Status = "stopped"
+			}
+		}
+		list = append(list, info)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+type connInfo struct {
+	Servant    string    `json:"servant"`
+	RemoteAddr string    `json:"remoteAddr"`
+	LastActive time.Time `json:"lastActive"`
+	Requests   int       `json:"requests"`
+	Streams    int       `json:"streams"`
+}
+
+func adminConns(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("servant")
+	list := make([]*connInfo, 0)
+	eachRpcServer(func(srv *rpcServer) {
+		if name != "" && srv.name != name {
+			return
+		}
+		for _, sc := range srv.getConns() {
+			info := &connInfo{
+				Servant:    srv.name,
+				RemoteAddr: sc.conn.RemoteAddr().String(),
+				LastActive: time.Unix(0, sc.lastActive.Load()),
+			}
+			sc.reqMu.Lock()
+			info.Requests = len(sc.reqs)
+			sc.reqMu.Unlock()
+			sc.streamMu.Lock()
+			info.Streams = len(sc.streams)
+			sc.streamMu.Unlock()
+			list = append(list, info)
+		}
+	})
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Servant != list[j].Servant {
+			return list[i].Servant < list[j].Servant
+		}
+		return list[i].RemoteAddr < list[j].RemoteAddr
+	})
+	writeJSON(w, http.StatusOK, list)
+}
+
+type clientEndpointInfo struct {
+	*Endpoint
+	Conns   int    `json:"conns"`
+	Breaker string `json:"breaker,omitempty"`
+}
+
+type clientInfo struct {
+	Service   string                `json:"service"`
+	Balancer  string                `json:"balancer,omitempty"`
+	Endpoints []*clientEndpointInfo `json:"endpoints"`
+}
+
+func adminClients(w http.ResponseWriter, r *http.Request) {
+	list := make([]*clientInfo, 0)
+	clients.Range(func(key, _ any) bool {
+		list = append(list, key.(*Client).info())
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Service < list[j].Service
+	})
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (client *Client) info() *clientInfo {
+	conns := client.poolConnNum()
+	client.mux.Lock()
+	defer client.mux.Unlock()
+	info := &clientInfo{
+		Service:   client.service,
+		Balancer:  client.cfg.Balancer,
+		Endpoints: make([]*clientEndpointInfo, 0, len(client.endpoints)),
+	}
+	for _, endpoint := range client.endpoints {
+		ipport := endpoint.IPPort()
+		e := &clientEndpointInfo{Endpoint: endpoint, Conns: conns[ipport]}
+		if br, ok := client.breakers[ipport]; ok {
+			br.mu.Lock()
+			e.Breaker = br.state.String()
+			br.mu.Unlock()
+		}
+		info.Endpoints = append(info.Endpoints, e)
+	}
+	return info
+}
+
+// adminConfig 输出的配置中 token 与密钥已被替换
+func adminConfig(w http.ResponseWriter, r *http.Request) {
+	conf, err := config.GetConfig().Redacted()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	bs, err := yaml.Marshal(conf)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	w.Write(bs)
+}
+
+func adminLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		lv, err := tlog.ParseLevel(r.URL.Query().Get("level"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		tlog.SetLevel(lv)
+		tlog.Info("set log level", tlog.Any("level", lv))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"level": tlog.GetLevel().String()})
+}
+
+func adminDrain(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	name := r.URL.Query().Get("servant")
+	if getServant(name) == nil || name == config.AdminServantName {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "servant not found"})
+		return
+	}
+	if err := drainServant(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"servant": name, "status": "stopped"})
+}
+
+func adminReload(w http.ResponseWriter, r *http.Request) {
+	if !requirePost(w, r) {
+		return
+	}
+	if err := reloadConfig(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "reloaded"})
+}
+
+func adminRateLimit(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("servant")
+	var limiter *rateLimiter
+	switch srv := getServant(name).(type) {
+	case *rpcServer:
+		limiter = srv.rateLimiter
+	case *httpServer:
+		limiter = srv.rateLimiter
+	}
+	if limiter == nil || name == config.AdminServantName {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "servant not found"})
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		cfg, err := config.ParseRateLimitConf(body)
+		if err == nil {
+			err = limiter.update(cfg)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		tlog.Info("set rate limit", tlog.Any("servant", name), tlog.Any("rules", len(cfg.Rules)))
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+	bs, err := yaml.Marshal(limiter.config())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	w.Write(bs)
+}
@@ -0,0 +1,506 @@
+package civet
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	errors2 "github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/meta"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Principal 通过认证的调用方
+type Principal struct {
+	Name string
+	// tls、bearer、hmac 或 jwt
+	Method string
+	// jwt 的 claims，其他认证方式为 nil
+	Claims map[string]any
+}
+
+type principalKey struct{}
+
+func newPrincipalContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext 开启认证的 servant 处理请求时的调用方
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
+
+// AuthHeader 请求 header，http.Header 与 rpc 的 header 都实现了该接口
+type AuthHeader interface {
+	Get(key string) string
+}
+
+type mapHeader map[string]string
+
+func (h mapHeader) Get(key string) string {
+	return h[key]
+}
+
+// authMaxBodySize 认证时读取的 http 请求体的上限
+const authMaxBodySize = 10 << 20
+
+type AuthRequest struct {
+	// rpc 为 servant/method，http 为 path
+	Route  string
+	Header AuthHeader
+	Peer   *Peer
+
+	body func() ([]byte, error)
+}
+
+// Body 请求体，rpc 流为空；http 请求在第一次调用时读取，并替换 Request.Body 供 handler 继续读取
+func (r *AuthRequest) Body() ([]byte, error) {
+	if r.body == nil {
+		return nil, nil
+	}
+	return r.body()
+}
+
+func httpRequestBody(req *http.Request) func() ([]byte, error) {
+	var (
+		body []byte
+		err  error
+		read bool
+	)
+	return func() ([]byte, error) {
+		if read {
+			return body, err
+		}
+		read = true
+		body, err = io.ReadAll(io.LimitReader(req.Body, authMaxBodySize+1))
+		if err == nil && len(body) > authMaxBodySize {
+			err = errors.New("request body too large")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return body, err
+	}
+}
+
+// Authenticator 请求中没有该方式的凭证时返回 nil, nil，由下一个 Authenticator 处理；凭证无效时返回错误
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *AuthRequest) (*Principal, error)
+}
+
+// Auth 按顺序使用 Authenticator 认证，再按 ACL 检查调用方是否可以访问路由
+type Auth struct {
+	authenticators []Authenticator
+	acl            map[string][]string
+}
+
+// NewAuth acl 为路由到允许的调用方，规则与配置中的 acl 相同
+func NewAuth(acl map[string][]string, authenticators ...Authenticator) *Auth {
+	return &Auth{
+		authenticators: authenticators,
+		acl:            acl,
+	}
+}
+
+func newAuthFromConf(cfg *config.AuthConf) (*Auth, error) {
+	authenticators := make([]Authenticator, 0)
+	if cfg.TLS {
+		authenticators = append(authenticators, NewTLSAuthenticator())
+	}
+	if len(cfg.BearerTokens) > 0 {
+		authenticators = append(authenticators, NewBearerAuthenticator(cfg.BearerTokens))
+	}
+	if len(cfg.HMACKeys) > 0 {
+		authenticators = append(authenticators, NewHMACAuthenticator(cfg.HMACKeys, cfg.HMACWindow))
+	}
+	if cfg.JWT != nil {
+		jwt, err := NewJWTAuthenticator(cfg.JWT.JWKSFile, cfg.JWT.Issuer, cfg.JWT.Audience, cfg.JWT.Leeway)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, jwt)
+	}
+	if len(authenticators) == 0 {
+		return nil, fmt.Errorf("no authenticator configured")
+	}
+	return NewAuth(cfg.ACL, authenticators...), nil
+}
+
+// authenticate 返回保存了 Principal 的 ctx，失败时返回 401 或 403 的错误
+func (a *Auth) authenticate(ctx context.Context, req *AuthRequest) (context.Context, error) {
+	var principal *Principal
+	for _, authenticator := range a.authenticators {
+		p, err := authenticator.Authenticate(ctx, req)
+		if err != nil {
+			return ctx, errors2.NewError("", 401, "unauthenticated: "+err.Error())
+		}
+		if p != nil {
+			principal = p
+			break
+		}
+	}
+	if principal == nil {
+		return ctx, errors2.ErrUnauthenticated
+	}
+	if !a.allowed(req.Route, principal.Name) {
+		return ctx, errors2.ErrPermissionDenied
+	}
+	return newPrincipalContext(ctx, principal), nil
+}
+
+// allowed 依次匹配 route、逐级的 prefix/* 与 *
+func (a *Auth) allowed(route, name string) bool {
+	principals, ok := a.acl[route]
+	for prefix := route; !ok; {
+		i := strings.LastIndex(prefix, "/")
+		if i < 0 {
+			principals, ok = a.acl["*"]
+			break
+		}
+		prefix = prefix[:i]
+		principals, ok = a.acl[prefix+"/*"]
+	}
+	if !ok {
+		return true
+	}
+	for _, p := range principals {
+		if p == "*" || p == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WithServerAuth 开启认证，覆盖配置中的 auth
+func WithServerAuth(auth *Auth) ServerOption {
+	return func(srv *rpcServer) {
+		srv.auth = auth
+	}
+}
+
+// WithHttpAuth 开启认证，覆盖配置中的 auth
+func WithHttpAuth(auth *Auth) HttpServerOption {
+	return func(srv *httpServer) {
+		srv.auth = auth
+	}
+}
+
+func (a *Auth) serverInterceptor(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) ([]byte, error) {
+	header, _ := meta.FromMetaContextReqContext(ctx)
+	route, _ := meta.RouteFromContext(ctx)
+	peer, _ := PeerFromContext(ctx)
+	ctx, err := a.authenticate(ctx, &AuthRequest{Route: route, Header: mapHeader(header), Peer: peer, body: func() ([]byte, error) {
+		return in, nil
+	}})
+	if err != nil {
+		return nil, err
+	}
+	return dispatch(ctx, impl, enc, method, in)
+}
+
+func (a *Auth) httpInterceptor(w http.ResponseWriter, req *http.Request, handler http.HandlerFunc) {
+	route, _ := meta.RouteFromContext(req.Context())
+	peer, _ := PeerFromContext(req.Context())
+	ctx, err := a.authenticate(req.Context(), &AuthRequest{Route: route, Header: req.Header, Peer: peer, body: httpRequestBody(req)})
+	if err != nil {
+		e := errors2.ParseError(err)
+		if e.Code == 401 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+		http.Error(w, e.Desc, int(e.Code))
+		return
+	}
+	handler(w, req.WithContext(ctx))
+}
+
+type tlsAuthenticator struct{}
+
+// NewTLSAuthenticator 使用客户端证书的 CommonName 作为调用方，证书由 TLS 握手校验
+func NewTLSAuthenticator() Authenticator {
+	return tlsAuthenticator{}
+}
+
+func (tlsAuthenticator) Authenticate(ctx context.Context, req *AuthRequest) (*Principal, error) {
+	if req.Peer == nil {
+		return nil, nil
+	}
+	cert := req.Peer.Certificate()
+	if cert == nil || len(req.Peer.TLS.VerifiedChains) == 0 {
+		return nil, nil
+	}
+	return &Principal{Name: cert.Subject.CommonName, Method: "tls"}, nil
+}
+
+func bearerToken(header AuthHeader) string {
+	auth := header.Get(meta.Authorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return auth[7:]
+	}
+	return ""
+}
+
+type bearerAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewBearerAuthenticator tokens 为 token 到调用方的映射
+func NewBearerAuthenticator(tokens map[string]string) Authenticator {
+	return &bearerAuthenticator{tokens: tokens}
+}
+
+func (a *bearerAuthenticator) Authenticate(ctx context.Context, req *AuthRequest) (*Principal, error) {
+	token := bearerToken(req.Header)
+	if token == "" {
+		return nil, nil
+	}
+	name, ok := a.tokens[token]
+	if !ok {
+		// JWT 交给后面的 Authenticator
+		if strings.Count(token, ".") == 2 {
+			return nil, nil
+		}
+		return nil, errors.New("invalid token")
+	}
+	return &Principal{Name: name, Method: "bearer"}, nil
+}
+
+type hmacAuthenticator struct {
+	keys   map[string]string
+	window time.Duration
+
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewHMACAuthenticator keys 为 keyId 到密钥的映射，timestamp 与当前时间相差超过 window 或 nonce 在 window 内重复的请求被拒绝。
+// 签名覆盖请求体与 AuthSignedHeaders 中列出的 header，rpc 请求的所有 header 都必须签名；
+// http 请求中未签名的 header 可以被篡改，需要保护的业务 header 应由客户端加入签名
+func NewHMACAuthenticator(keys map[string]string, window time.Duration) Authenticator {
+	return &hmacAuthenticator{
+		keys:      keys,
+		window:    window,
+		nonces:    make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+// hmacRequiredHeaders 总是需要签名的 header，hmacProtectedHeaders 出现在请求中时需要签名
+var (
+	hmacRequiredHeaders  = []string{meta.AuthKeyId, meta.AuthTimestamp, meta.AuthNonce}
+	hmacProtectedHeaders = []string{meta.ContentType, meta.Caller, meta.Priority, meta.Timeout}
+)
+
+// hmacStringToSign 每行依次为 route、body 的 sha256、参与签名的 header 名与按该顺序的 "name:value"。
+// header 名不能包含 ; 与 :，值不能包含换行，避免不同的请求得到相同的签名内容
+func hmacStringToSign(route string, body []byte, header AuthHeader, signedHeaders []string) (string, error) {
+	sum := sha256.Sum256(body)
+	var b strings.Builder
+	b.WriteString(route)
+	b.WriteByte('\n')
+	b.WriteString(hex.EncodeToString(sum[:]))
+	b.WriteByte('\n')
+	b.WriteString(strings.Join(signedHeaders, ";"))
+	for _, name := range signedHeaders {
+		value := header.Get(name)
+		if name == "" || strings.ContainsAny(name, ";:\r\n") || strings.ContainsAny(value, "\r\n") {
+			return "", fmt.Errorf("header %q can not be signed", name)
+		}
+		b.WriteByte('\n')
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+func hmacSign(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkSignedHeaders 必须签名的 header 不在 signedHeaders 中时返回错误
+func checkSignedHeaders(header AuthHeader, signedHeaders []string) error {
+	signed := func(name string) bool {
+		for _, s := range signedHeaders {
+			if strings.EqualFold(s, name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range hmacRequiredHeaders {
+		if !signed(name) {
+			return fmt.Errorf("header %s is not signed", name)
+		}
+	}
+	for _, name := range hmacProtectedHeaders {
+		if header.Get(name) != "" && !signed(name) {
+			return fmt.Errorf("header %s is not signed", name)
+		}
+	}
+	// rpc 客户端对所有 header 签名
+	if h, ok := header.(mapHeader); ok {
+		for name := range h {
+			if name != meta.AuthSignature && name != meta.AuthSignedHeaders && !signed(name) {
+				return fmt.Errorf("header %s is not signed", name)
+			}
+		}
+	}
+	return nil
+}
+
+func (a *hmacAuthenticator) Authenticate(ctx context.Context, req *AuthRequest) (*Principal, error) {
+	keyId := req.Header.Get(meta.AuthKeyId)
+	if keyId == "" {
+		return nil, nil
+	}
+	secret, ok := a.keys[keyId]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", keyId)
+	}
+	timestamp, nonce := req.Header.Get(meta.AuthTimestamp), req.Header.Get(meta.AuthNonce)
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || nonce == "" {
+		return nil, errors.New("invalid timestamp or nonce")
+	}
+	signedHeaders := strings.Split(req.Header.Get(meta.AuthSignedHeaders), ";")
+	if err = checkSignedHeaders(req.Header, signedHeaders); err != nil {
+		return nil, err
+	}
+	body, err := req.Body()
+	if err != nil {
+		return nil, err
+	}
+	stringToSign, err := hmacStringToSign(req.Route, body, req.Header, signedHeaders)
+	if err != nil {
+		return nil, err
+	}
+	signature := hmacSign(secret, stringToSign)
+	if subtle.ConstantTimeCompare([]byte(signature), []byte(req.Header.Get(meta.AuthSignature))) != 1 {
+		return nil, errors.New("invalid signature")
+	}
+	ts := time.Unix(sec, 0)
+	if d := time.Since(ts); d > a.window || d < -a.window {
+		return nil, errors.New("timestamp out of window")
+	}
+	if !a.addNonce(keyId+"/"+nonce, ts) {
+		return nil, errors.New("replayed request")
+	}
+	return &Principal{Name: keyId, Method: "hmac"}, nil
+}
+
+// addNonce nonce 已经出现过时返回 false，超出窗口的 nonce 定期清理
+func (a *hmacAuthenticator) addNonce(nonce string, ts time.Time) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if now.Sub(a.lastSweep) > a.window {
+		for k, t := range a.nonces {
+			if now.Sub(t) > a.window {
+				delete(a.nonces, k)
+			}
+		}
+		a.lastSweep = now
+	}
+	if _, ok := a.nonces[nonce]; ok {
+		return false
+	}
+	a.nonces[nonce] = ts
+	return true
+}
+
+// Credentials 客户端每次发送请求前调用，向 header 中写入凭证；body 为请求体，打开流时为空
+type Credentials interface {
+	Apply(route string, header map[string]string, body []byte) error
+}
+
+type bearerCredentials string
+
+// NewBearerCredentials 使用静态 token 或 JWT
+func NewBearerCredentials(token string) Credentials {
+	return bearerCredentials(token)
+}
+
+func (c bearerCredentials) Apply(route string, header map[string]string, body []byte) error {
+	header[meta.Authorization] = "Bearer " + string(c)
+	return nil
+}
+
+type hmacCredentials struct {
+	keyId  string
+	secret string
+}
+
+// NewHMACCredentials 每次请求使用新的 timestamp 与 nonce 对请求体与所有 header 签名，重试与对冲的请求也会重新签名。
+// 流只对打开流的请求签名
+func NewHMACCredentials(keyId, secret string) Credentials {
+	return &hmacCredentials{keyId: keyId, secret: secret}
+}
+
+func (c *hmacCredentials) Apply(route string, header map[string]string, body []byte) error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	header[meta.AuthKeyId] = c.keyId
+	header[meta.AuthTimestamp] = strconv.FormatInt(time.Now().Unix(), 10)
+	header[meta.AuthNonce] = hex.EncodeToString(b)
+	delete(header, meta.AuthSignature)
+	delete(header, meta.AuthSignedHeaders)
+	signedHeaders := make([]string, 0, len(header))
+	for name := range header {
+		signedHeaders = append(signedHeaders, name)
+	}
+	sort.Strings(signedHeaders)
+	stringToSign, err := hmacStringToSign(route, body, mapHeader(header), signedHeaders)
+	if err != nil {
+		return err
+	}
+	header[meta.AuthSignedHeaders] = strings.Join(signedHeaders, ";")
+	header[meta.AuthSignature] = hmacSign(c.secret, stringToSign)
+	return nil
+}
+
+func newCredentialsFromConf(cfg *config.CredentialsConf) Credentials {
+	if cfg.HMACKeyId != "" {
+		return NewHMACCredentials(cfg.HMACKeyId, cfg.HMACSecret)
+	}
+	if cfg.Token != "" {
+		return NewBearerCredentials(cfg.Token)
+	}
+	return nil
+}
+
+// WithClientCredentials 设置请求携带的凭证，覆盖配置中的 credentials
+func WithClientCredentials(creds Credentials) ClientOption {
+	return func(client *Client) {
+		client.credentials = creds
+	}
+}
+
+// authHeaders 认证相关的 header，不随请求上下文转发给下游
+var authHeaders = []string{meta.Authorization, meta.AuthKeyId, meta.AuthTimestamp, meta.AuthNonce, meta.AuthSignature, meta.AuthSignedHeaders}
+
+// applyCredentials 先删除从上游请求继承的凭证，再设置客户端自己的凭证
+func (client *Client) applyCredentials(reqMsg *Request) error {
+	for _, key := range authHeaders {
+		delete(reqMsg.Header, key)
+	}
+	if client.credentials == nil {
+		return nil
+	}
+	return client.credentials.Apply(reqMsg.Route, reqMsg.Header, reqMsg.Body)
+}
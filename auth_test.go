@@ -0,0 +1,214 @@
+package civet
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YCloud/civet/meta"
+)
+
+func newSignedRequest(t *testing.T, route string, header map[string]string, body []byte) *AuthRequest {
+	t.Helper()
+	if err := NewHMACCredentials("k1", "secret").Apply(route, header, body); err != nil {
+		t.Fatal(err)
+	}
+	return &AuthRequest{Route: route, Header: mapHeader(header), body: func() ([]byte, error) {
+		return body, nil
+	}}
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	const route = "hello/SayHello"
+	body := []byte(`{"name":"civet"}`)
+	newHeader := func() map[string]string {
+		return map[string]string{meta.ContentType: "json", meta.Caller: "demo.client", meta.Timeout: "1000"}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(req *AuthRequest, header map[string]string)
+		err    string
+	}{
+		{"valid", func(*AuthRequest, map[string]string) {}, ""},
+		{"tampered body", func(req *AuthRequest, _ map[string]string) {
+			req.body = func() ([]byte, error) { return []byte(`{"name":"other"}`), nil }
+		}, "invalid signature"},
+		{"tampered route", func(req *AuthRequest, _ map[string]string) {
+			req.Route = "hello/Other"
+		}, "invalid signature"},
+		{"tampered caller", func(_ *AuthRequest, h map[string]string) {
+			h[meta.Caller] = "admin"
+		}, "invalid signature"},
+		{"tampered signature", func(_ *AuthRequest, h map[string]string) {
+			h[meta.AuthSignature] = strings.Repeat("0", 64)
+		}, "invalid signature"},
+		{"unsigned priority", func(_ *AuthRequest, h map[string]string) {
+			h[meta.Priority] = meta.PriorityCritical
+		}, "header Priority is not signed"},
+		{"unsigned header", func(_ *AuthRequest, h map[string]string) {
+			h["X-Tenant"] = "t1"
+		}, "header X-Tenant is not signed"},
+		{"signed headers removed", func(_ *AuthRequest, h map[string]string) {
+			h[meta.AuthSignedHeaders] = meta.AuthKeyId + ";" + meta.AuthNonce + ";" + meta.AuthTimestamp
+		}, "header ContentType is not signed"},
+		{"unknown key", func(_ *AuthRequest, h map[string]string) {
+			h[meta.AuthKeyId] = "k2"
+		}, "unknown key k2"},
+		{"timestamp out of window", func(_ *AuthRequest, h map[string]string) {
+			h[meta.AuthTimestamp] = strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+		}, "invalid signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewHMACAuthenticator(map[string]string{"k1": "secret"}, time.Minute)
+			header := newHeader()
+			req := newSignedRequest(t, route, header, body)
+			tt.modify(req, header)
+			p, err := a.Authenticate(context.Background(), req)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != "k1" || p.Method != "hmac" {
+				t.Fatalf("principal = %+v", p)
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticatorReplay(t *testing.T) {
+	a := NewHMACAuthenticator(map[string]string{"k1": "secret"}, time.Minute)
+	req := newSignedRequest(t, "hello/SayHello", map[string]string{}, nil)
+	if _, err := a.Authenticate(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(context.Background(), req); err == nil || err.Error() != "replayed request" {
+		t.Fatalf("err = %v, want replayed request", err)
+	}
+}
+
+func TestHMACAuthenticatorWindow(t *testing.T) {
+	a := NewHMACAuthenticator(map[string]string{"k1": "secret"}, time.Minute)
+	header := map[string]string{}
+	creds := NewHMACCredentials("k1", "secret").(*hmacCredentials)
+	if err := creds.Apply("hello/SayHello", header, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 使用过期的 timestamp 重新签名
+	header[meta.AuthTimestamp] = strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	stringToSign, err := hmacStringToSign("hello/SayHello", nil, mapHeader(header), strings.Split(header[meta.AuthSignedHeaders], ";"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header[meta.AuthSignature] = hmacSign("secret", stringToSign)
+	_, err = a.Authenticate(context.Background(), &AuthRequest{Route: "hello/SayHello", Header: mapHeader(header)})
+	if err == nil || err.Error() != "timestamp out of window" {
+		t.Fatalf("err = %v, want timestamp out of window", err)
+	}
+}
+
+func TestHMACAuthenticatorHTTP(t *testing.T) {
+	body := `{"name":"civet"}`
+	header := map[string]string{meta.Caller: "demo.client"}
+	if err := NewHMACCredentials("k1", "secret").Apply("/hello", header, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	auth := NewAuth(nil, NewHMACAuthenticator(map[string]string{"k1": "secret"}, time.Minute))
+	serve := func(body string, extra map[string]string) (int, string) {
+		r := httptest.NewRequest(http.MethodPost, "/hello", strings.NewReader(body))
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		for k, v := range extra {
+			r.Header.Set(k, v)
+		}
+		r = r.WithContext(meta.NewRouteContext(r.Context(), "/hello"))
+		w := httptest.NewRecorder()
+		var got string
+		auth.httpInterceptor(w, r, func(w http.ResponseWriter, r *http.Request) {
+			bs, _ := io.ReadAll(r.Body)
+			got = string(bs)
+		})
+		return w.Code, got
+	}
+
+	// 未签名的其他 http header 不影响认证，认证后 handler 仍能读到完整 body
+	if code, got := serve(body, map[string]string{"User-Agent": "test"}); code != http.StatusOK || got != body {
+		t.Fatalf("code = %d, body = %q", code, got)
+	}
+	if code, _ := serve(body, nil); code != http.StatusUnauthorized {
+		t.Fatalf("replayed: code = %d, want 401", code)
+	}
+	if err := NewHMACCredentials("k1", "secret").Apply("/hello", header, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := serve(`{"name":"other"}`, nil); code != http.StatusUnauthorized {
+		t.Fatalf("tampered body: code = %d, want 401", code)
+	}
+	if code, _ := serve(body, map[string]string{meta.Caller: "admin"}); code != http.StatusUnauthorized {
+		t.Fatalf("tampered caller: code = %d, want 401", code)
+	}
+}
+
+func TestApplyCredentialsStripsInheritedAuth(t *testing.T) {
+	inherited := func() map[string]string {
+		return map[string]string{
+			meta.Authorization:     "Bearer upstream",
+			meta.AuthKeyId:         "upstream",
+			meta.AuthTimestamp:     "1",
+			meta.AuthNonce:         "n",
+			meta.AuthSignature:     "s",
+			meta.AuthSignedHeaders: meta.AuthKeyId,
+			meta.Caller:            "demo.client",
+		}
+	}
+	tests := []struct {
+		name  string
+		creds Credentials
+		want  map[string]string
+	}{
+		{"without credentials", nil, map[string]string{meta.Caller: "demo.client"}},
+		{"bearer", NewBearerCredentials("own"), map[string]string{meta.Caller: "demo.client", meta.Authorization: "Bearer own"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{credentials: tt.creds}
+			req := &Request{Route: "hello/SayHello", Header: inherited()}
+			if err := client.applyCredentials(req); err != nil {
+				t.Fatal(err)
+			}
+			if len(req.Header) != len(tt.want) {
+				t.Fatalf("header = %v, want %v", req.Header, tt.want)
+			}
+			for k, v := range tt.want {
+				if req.Header[k] != v {
+					t.Fatalf("header = %v, want %v", req.Header, tt.want)
+				}
+			}
+		})
+	}
+
+	client := &Client{credentials: NewHMACCredentials("k1", "secret")}
+	req := &Request{Route: "hello/SayHello", Header: inherited()}
+	if err := client.applyCredentials(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := req.Header[meta.Authorization]; ok || req.Header[meta.AuthKeyId] != "k1" {
+		t.Fatalf("header = %v", req.Header)
+	}
+	a := NewHMACAuthenticator(map[string]string{"k1": "secret"}, time.Minute)
+	if _, err := a.Authenticate(context.Background(), &AuthRequest{Route: req.Route, Header: mapHeader(req.Header)}); err != nil {
+		t.Fatal(err)
+	}
+}
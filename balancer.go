@@ -0,0 +1,293 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrNoEndpoint = errors.New("no available endpoint")
+
+const (
+	BalancerRoundRobin   = "round_robin"
+	BalancerLeastRequest = "least_request"
+	BalancerP2C          = "p2c"
+	BalancerHash         = "hash"
+)
+
+type PickInfo struct {
+	Ctx     context.Context
+	Request *Request
+	// 本次选择需要跳过的节点，key 为 IPPort
+	Exclude map[string]bool
+}
+
+// Balancer 负载均衡，Update 与 Pick 可能并发调用
+type Balancer interface {
+	// Update 节点列表变化时调用
+	Update(endpoints []*Endpoint)
+	// Pick 选择一个节点，done 在请求结束时调用
+	Pick(info *PickInfo) (endpoint *Endpoint, done func(err error), err error)
+}
+
+// NewBalancer 按名称创建内置的负载均衡，hashKey 只用于 hash
+func NewBalancer(name string, hashKey string) (Balancer, error) {
+	switch name {
+	case "", BalancerRoundRobin:
+		return NewRoundRobinBalancer(), nil
+	case BalancerLeastRequest:
+		return NewLeastRequestBalancer(), nil
+	case BalancerP2C:
+		return NewP2CBalancer(), nil
+	case BalancerHash:
+		return NewHashBalancer(hashKey), nil
+	default:
+		return nil, fmt.Errorf("unknown balancer %s", name)
+	}
+}
+
+func endpointWeight(endpoint *Endpoint) int64 {
+	if endpoint.Weight <= 0 {
+		return 1
+	}
+	return int64(endpoint.Weight)
+}
+
+func noopDone(error) {}
+
+type rrNode struct {
+	endpoint *Endpoint
+	weight   int64
+	current  int64
+}
+
+type roundRobinBalancer struct {
+	mu    sync.Mutex
+	nodes []*rrNode
+}
+
+// NewRoundRobinBalancer 平滑加权轮询
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{}
+}
+
+func (b *roundRobinBalancer) Update(endpoints []*Endpoint) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	old := make(map[string]*rrNode, len(b.nodes))
+	for _, n := range b.nodes {
+		old[n.endpoint.IPPort()] = n
+	}
+	nodes := make([]*rrNode, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		n := &rrNode{endpoint: endpoint, weight: endpointWeight(endpoint)}
+		if o, ok := old[endpoint.IPPort()]; ok {
+			n.current = o.current
+		}
+		nodes = append(nodes, n)
+	}
+	b.nodes = nodes
+}
+
+func (b *roundRobinBalancer) Pick(info *PickInfo) (*Endpoint, func(error), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var (
+		best  *rrNode
+		total int64
+	)
+	for _, n := range b.nodes {
+		if info.Exclude[n.endpoint.IPPort()] {
+			continue
+		}
+		n.current += n.weight
+		total += n.weight
+		if best == nil || n.current > best.current {
+			best = n
+		}
+	}
+	if best == nil {
+		return nil, nil, ErrNoEndpoint
+	}
+	best.current -= total
+	return best.endpoint, noopDone, nil
+}
+
+// outstanding 记录每个节点正在进行的请求数
+type outstanding struct {
+	mu        sync.RWMutex
+	endpoints []*Endpoint
+	counts    map[string]*atomic.Int64
+}
+
+func (o *outstanding) Update(endpoints []*Endpoint) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	counts := make(map[string]*atomic.Int64, len(endpoints))
+	for _, endpoint := range endpoints {
+		ipport := endpoint.IPPort()
+		if c, ok := o.counts[ipport]; ok {
+			counts[ipport] = c
+		} else {
+			counts[ipport] = &atomic.Int64{}
+		}
+	}
+	o.endpoints = endpoints
+	o.counts = counts
+}
+
+// candidates 返回未排除的节点与对应的计数
+func (o *outstanding) candidates(exclude map[string]bool) ([]*Endpoint, []*atomic.Int64) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	endpoints := make([]*Endpoint, 0, len(o.endpoints))
+	counts := make([]*atomic.Int64, 0, len(o.endpoints))
+	for _, endpoint := range o.endpoints {
+		ipport := endpoint.IPPort()
+		if exclude[ipport] {
+			continue
+		}
+		endpoints = append(endpoints, endpoint)
+		counts = append(counts, o.counts[ipport])
+	}
+	return endpoints, counts
+}
+
+// load 按权重折算后的负载
+func load(endpoint *Endpoint, count *atomic.Int64) float64 {
+	return float64(count.Load()+1) / float64(endpointWeight(endpoint))
+}
+
+func acquire(count *atomic.Int64) func(error) {
+	count.Add(1)
+	return func(error) {
+		count.Add(-1)
+	}
+}
+
+type leastRequestBalancer struct {
+	outstanding
+	next atomic.Uint32
+}
+
+// NewLeastRequestBalancer 选择正在进行的请求数最少的节点
+func NewLeastRequestBalancer() Balancer {
+	return &leastRequestBalancer{}
+}
+
+func (b *leastRequestBalancer) Pick(info *PickInfo) (*Endpoint, func(error), error) {
+	endpoints, counts := b.candidates(info.Exclude)
+	if len(endpoints) == 0 {
+		return nil, nil, ErrNoEndpoint
+	}
+	// 从轮转的位置开始比较，负载相同时请求分散到不同节点
+	start := int(b.next.Add(1))
+	best := -1
+	for i := range endpoints {
+		j := (start + i) % len(endpoints)
+		if best < 0 || load(endpoints[j], counts[j]) < load(endpoints[best], counts[best]) {
+			best = j
+		}
+	}
+	return endpoints[best], acquire(counts[best]), nil
+}
+
+type p2cBalancer struct {
+	outstanding
+}
+
+// NewP2CBalancer 随机选择两个节点，取负载低的一个
+func NewP2CBalancer() Balancer {
+	return &p2cBalancer{}
+}
+
+func (b *p2cBalancer) Pick(info *PickInfo) (*Endpoint, func(error), error) {
+	endpoints, counts := b.candidates(info.Exclude)
+	if len(endpoints) == 0 {
+		return nil, nil, ErrNoEndpoint
+	}
+	i := rand.Intn(len(endpoints))
+	if len(endpoints) > 1 {
+		j := rand.Intn(len(endpoints) - 1)
+		if j >= i {
+			j++
+		}
+		if load(endpoints[j], counts[j]) < load(endpoints[i], counts[i]) {
+			i = j
+		}
+	}
+	return endpoints[i], acquire(counts[i]), nil
+}
+
+const hashReplicas = 64
+
+type ringNode struct {
+	hash     uint32
+	endpoint *Endpoint
+}
+
+type hashBalancer struct {
+	key      string
+	mu       sync.RWMutex
+	ring     []ringNode
+	fallback Balancer
+}
+
+// NewHashBalancer 按请求 header 中 key 的值做一致性 hash，每个节点的虚拟节点数与权重成正比；
+// header 中没有 key 时退化为加权轮询
+func NewHashBalancer(key string) Balancer {
+	return &hashBalancer{
+		key:      key,
+		fallback: NewRoundRobinBalancer(),
+	}
+}
+
+func (b *hashBalancer) Update(endpoints []*Endpoint) {
+	ring := make([]ringNode, 0, len(endpoints)*hashReplicas)
+	for _, endpoint := range endpoints {
+		ipport := endpoint.IPPort()
+		n := int(endpointWeight(endpoint)) * hashReplicas
+		for i := 0; i < n; i++ {
+			ring = append(ring, ringNode{
+				hash:     crc32.ChecksumIEEE([]byte(fmt.Sprintf("%s#%d", ipport, i))),
+				endpoint: endpoint,
+			})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	b.mu.Lock()
+	b.ring = ring
+	b.mu.Unlock()
+	b.fallback.Update(endpoints)
+}
+
+func (b *hashBalancer) Pick(info *PickInfo) (*Endpoint, func(error), error) {
+	var value string
+	if info.Request != nil {
+		value = info.Request.Header[b.key]
+	}
+	if value == "" {
+		return b.fallback.Pick(info)
+	}
+	h := crc32.ChecksumIEEE([]byte(value))
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	n := len(b.ring)
+	start := sort.Search(n, func(i int) bool {
+		return b.ring[i].hash >= h
+	})
+	for i := 0; i < n; i++ {
+		node := b.ring[(start+i)%n]
+		if !info.Exclude[node.endpoint.IPPort()] {
+			return node.endpoint, noopDone, nil
+		}
+	}
+	return nil, nil, ErrNoEndpoint
+}
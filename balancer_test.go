@@ -0,0 +1,173 @@
+package civet
+
+import (
+	"strconv"
+	"testing"
+)
+
+func newTestEndpoints(weights ...int) []*Endpoint {
+	endpoints := make([]*Endpoint, 0, len(weights))
+	for i, weight := range weights {
+		endpoints = append(endpoints, &Endpoint{IP: "127.0.0.1", Port: strconv.Itoa(10001 + i), Weight: int32(weight)})
+	}
+	return endpoints
+}
+
+// pickN 选择 n 次并返回每个节点被选中的次数，hold 为 true 时请求不结束
+func pickN(t *testing.T, b Balancer, n int, hold bool, exclude map[string]bool) map[string]int {
+	t.Helper()
+	got := make(map[string]int)
+	for i := 0; i < n; i++ {
+		endpoint, done, err := b.Pick(&PickInfo{Exclude: exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[endpoint.IPPort()]++
+		if !hold {
+			done(nil)
+		}
+	}
+	return got
+}
+
+func TestBalancerDistribution(t *testing.T) {
+	tests := []struct {
+		name     string
+		balancer string
+		weights  []int
+		hold     bool
+		n        int
+		// 每个节点被选中的次数，与 weights 一一对应
+		want []int
+	}{
+		{"round robin equal", BalancerRoundRobin, []int{1, 1, 1}, false, 300, []int{100, 100, 100}},
+		{"round robin weighted", BalancerRoundRobin, []int{5, 1, 1}, false, 700, []int{500, 100, 100}},
+		{"round robin zero weight", BalancerRoundRobin, []int{0, 1, -1}, false, 30, []int{10, 10, 10}},
+		{"least request released", BalancerLeastRequest, []int{1, 1, 1}, false, 30, []int{10, 10, 10}},
+		{"least request outstanding", BalancerLeastRequest, []int{1, 1, 1}, true, 30, []int{10, 10, 10}},
+		{"least request weighted", BalancerLeastRequest, []int{2, 1, 1}, true, 40, []int{20, 10, 10}},
+		{"hash without key", BalancerHash, []int{3, 1}, false, 40, []int{30, 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBalancer(tt.balancer, "uid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			endpoints := newTestEndpoints(tt.weights...)
+			b.Update(endpoints)
+			got := pickN(t, b, tt.n, tt.hold, nil)
+			for i, endpoint := range endpoints {
+				if got[endpoint.IPPort()] != tt.want[i] {
+					t.Fatalf("picks = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestP2CBalancerDistribution(t *testing.T) {
+	b := NewP2CBalancer()
+	endpoints := newTestEndpoints(1, 1, 1, 1)
+	b.Update(endpoints)
+	// 请求都不结束时，两选一使各节点的请求数保持接近
+	got := pickN(t, b, 400, true, nil)
+	for _, endpoint := range endpoints {
+		if n := got[endpoint.IPPort()]; n < 90 || n > 110 {
+			t.Fatalf("picks = %v, want about 100 each", got)
+		}
+	}
+
+	// 只有两个节点时每次都比较两者，负载高的节点不会被选中
+	b = NewP2CBalancer()
+	endpoints = newTestEndpoints(1, 1)
+	b.Update(endpoints)
+	pickN(t, b, 10, true, map[string]bool{endpoints[1].IPPort(): true})
+	if got := pickN(t, b, 10, true, nil); got[endpoints[1].IPPort()] != 10 {
+		t.Fatalf("picks = %v, want only %s", got, endpoints[1].IPPort())
+	}
+}
+
+func TestBalancerExclude(t *testing.T) {
+	for _, name := range []string{BalancerRoundRobin, BalancerLeastRequest, BalancerP2C, BalancerHash} {
+		t.Run(name, func(t *testing.T) {
+			b, err := NewBalancer(name, "uid")
+			if err != nil {
+				t.Fatal(err)
+			}
+			endpoints := newTestEndpoints(1, 1, 1)
+			b.Update(endpoints)
+			exclude := map[string]bool{endpoints[0].IPPort(): true, endpoints[1].IPPort(): true}
+			got := pickN(t, b, 10, false, exclude)
+			if got[endpoints[2].IPPort()] != 10 {
+				t.Fatalf("picks = %v, want only %s", got, endpoints[2].IPPort())
+			}
+			exclude[endpoints[2].IPPort()] = true
+			if _, _, err := b.Pick(&PickInfo{Exclude: exclude}); err != ErrNoEndpoint {
+				t.Fatalf("err = %v, want ErrNoEndpoint", err)
+			}
+			b.Update(nil)
+			if _, _, err := b.Pick(&PickInfo{}); err != ErrNoEndpoint {
+				t.Fatalf("err = %v after empty update, want ErrNoEndpoint", err)
+			}
+		})
+	}
+}
+
+func TestHashBalancer(t *testing.T) {
+	b := NewHashBalancer("uid")
+	endpoints := newTestEndpoints(1, 1, 1)
+	b.Update(endpoints)
+	pick := func(uid string, exclude map[string]bool) *Endpoint {
+		endpoint, _, err := b.Pick(&PickInfo{Request: &Request{Header: map[string]string{"uid": uid}}, Exclude: exclude})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return endpoint
+	}
+
+	before := make(map[string]string)
+	count := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		uid := strconv.Itoa(i)
+		endpoint := pick(uid, nil)
+		if pick(uid, nil) != endpoint {
+			t.Fatalf("uid %s picked different endpoints", uid)
+		}
+		before[uid] = endpoint.IPPort()
+		count[endpoint.IPPort()]++
+	}
+	// 虚拟节点使 key 分散到所有节点，crc32 的分布不完全均匀
+	for _, endpoint := range endpoints {
+		if n := count[endpoint.IPPort()]; n < 500 {
+			t.Fatalf("picks = %v, want at least 500 each", count)
+		}
+	}
+
+	// 排除选中的节点时顺延到环上的下一个节点
+	for uid, ipport := range before {
+		if got := pick(uid, map[string]bool{ipport: true}); got.IPPort() == ipport {
+			t.Fatalf("uid %s picked excluded endpoint", uid)
+		}
+		break
+	}
+
+	// 移除一个节点只影响原来落在该节点上的 key
+	removed := endpoints[0].IPPort()
+	b.Update(endpoints[1:])
+	for uid, ipport := range before {
+		got := pick(uid, nil).IPPort()
+		if ipport != removed && got != ipport {
+			t.Fatalf("uid %s moved from %s to %s", uid, ipport, got)
+		}
+		if got == removed {
+			t.Fatalf("uid %s picked removed endpoint", uid)
+		}
+	}
+}
+
+func TestNewBalancerUnknown(t *testing.T) {
+	if _, err := NewBalancer("random", ""); err == nil {
+		t.Fatal("unknown balancer accepted")
+	}
+}
@@ -0,0 +1,213 @@
+package civet
+
+import (
+	"errors"
+	"fmt"
+	errors2 "github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/tlog"
+	"sync"
+	"time"
+)
+
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+type BreakerState uint8
+
+const (
+	// 正常放行
+	BreakerState_Closed BreakerState = 1 + iota
+	// 熔断，节点不参与选择
+	BreakerState_Open
+	// 熔断超时后放行少量探测请求
+	BreakerState_HalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerState_Closed:
+		return "closed"
+	case BreakerState_Open:
+		return "open"
+	case BreakerState_HalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("state(%d)", s)
+	}
+}
+
+type BreakerEvent struct {
+	Service  string
+	Endpoint string
+	From     BreakerState
+	To       BreakerState
+}
+
+// BreakerListener 熔断状态变化的回调，不能阻塞
+type BreakerListener func(ev *BreakerEvent)
+
+func WithClientBreakerListener(listener BreakerListener) ClientOption {
+	return func(client *Client) {
+		client.breakerListener = listener
+	}
+}
+
+// breaker 单个节点的熔断器，在统计窗口内请求数达到 MinRequests 且错误率或慢调用比例超过阈值时熔断，
+// 熔断 OpenTimeout 后进入半开状态，HalfOpenProbes 个探测请求全部成功后恢复
+type breaker struct {
+	cfg      *config.BreakerConf
+	onChange func(from, to BreakerState)
+
+	mu          sync.Mutex
+	state       BreakerState
+	openedAt    time.Time
+	windowStart time.Time
+	total       int32
+	failures    int32
+	slow        int32
+	probes      int32
+	successes   int32
+}
+
+func newBreaker(cfg *config.BreakerConf, onChange func(from, to BreakerState)) *breaker {
+	return &breaker{
+		cfg:         cfg,
+		onChange:    onChange,
+		state:       BreakerState_Closed,
+		windowStart: time.Now(),
+	}
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	from := b.state
+	allowed := false
+	switch b.state {
+	case BreakerState_Closed:
+		allowed = true
+	case BreakerState_Open:
+		if time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+			b.state = BreakerState_HalfOpen
+			b.probes = 1
+			allowed = true
+		}
+	case BreakerState_HalfOpen:
+		if b.probes < b.cfg.HalfOpenProbes {
+			b.probes++
+			allowed = true
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	return allowed
+}
+
+func (b *breaker) record(err error, latency time.Duration) {
+	failure := isBreakerFailure(err)
+	slow := b.cfg.SlowThreshold > 0 && latency >= b.cfg.SlowThreshold
+
+	b.mu.Lock()
+	from := b.state
+	switch b.state {
+	case BreakerState_Closed:
+		now := time.Now()
+		if now.Sub(b.windowStart) > b.cfg.Window {
+			b.windowStart = now
+			b.total, b.failures, b.slow = 0, 0, 0
+		}
+		b.total++
+		if failure {
+			b.failures++
+		}
+		if slow {
+			b.slow++
+		}
+		if b.total >= b.cfg.MinRequests &&
+			(float64(b.failures)/float64(b.total) >= b.cfg.ErrorRate ||
+				(b.cfg.SlowThreshold > 0 && float64(b.slow)/float64(b.total) >= b.cfg.SlowRate)) {
+			b.open()
+		}
+	case BreakerState_HalfOpen:
+		if failure || slow {
+			b.open()
+			break
+		}
+		b.successes++
+		if b.successes >= b.cfg.HalfOpenProbes {
+			b.state = BreakerState_Closed
+			b.windowStart = time.Now()
+			b.total, b.failures, b.slow = 0, 0, 0
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+// cancel 请求被主动取消时不计入统计，半开状态下归还探测名额，避免探测请求都被取消后无法恢复
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerState_HalfOpen && b.probes > b.successes {
+		b.probes--
+	}
+}
+
+func (b *breaker) open() {
+	b.state = BreakerState_Open
+	b.openedAt = time.Now()
+	b.probes, b.successes = 0, 0
+}
+
+func (b *breaker) notify(from, to BreakerState) {
+	if from != to && b.onChange != nil {
+		b.onChange(from, to)
+	}
+}
+
+// isBreakerFailure 连接错误、超时与 5xx 错误码计入失败，业务错误不计入
+func isBreakerFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, ErrBadConn) {
+		return true
+	}
+	var e *errors2.Error
+	if errors.As(err, &e) {
+		return e.Code >= 500 && e.Code < 600
+	}
+	return false
+}
+
+// getBreaker 未开启熔断时返回 nil
+func (client *Client) getBreaker(ipport string) *breaker {
+	cfg := client.cfg.Breaker
+	if cfg == nil {
+		return nil
+	}
+	client.mux.Lock()
+	defer client.mux.Unlock()
+	b, ok := client.breakers[ipport]
+	if !ok {
+		b = newBreaker(cfg, func(from, to BreakerState) {
+			client.onBreakerChange(ipport, from, to)
+		})
+		client.breakers[ipport] = b
+	}
+	return b
+}
+
+func (client *Client) onBreakerChange(ipport string, from, to BreakerState) {
+	tlog.Warn("circuit breaker state changed", tlog.Any("service", client.service), tlog.Any("endpoint", ipport),
+		tlog.Any("from", from), tlog.Any("to", to))
+	if client.breakerListener != nil {
+		client.breakerListener(&BreakerEvent{
+			Service:  client.service,
+			Endpoint: ipport,
+			From:     from,
+			To:       to,
+		})
+	}
+}
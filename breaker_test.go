@@ -0,0 +1,148 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	errors2 "github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/internal/config"
+)
+
+const testOpenTimeout = 20 * time.Millisecond
+
+func newTestBreakerConf() *config.BreakerConf {
+	return &config.BreakerConf{
+		Window:         time.Minute,
+		MinRequests:    4,
+		ErrorRate:      0.5,
+		SlowThreshold:  100 * time.Millisecond,
+		SlowRate:       0.5,
+		OpenTimeout:    testOpenTimeout,
+		HalfOpenProbes: 2,
+	}
+}
+
+// breakerStep 依次执行的操作，op 为 allow 时检查是否放行
+type breakerStep struct {
+	op      string
+	err     error
+	latency time.Duration
+	allowed bool
+}
+
+func allowStep(allowed bool) breakerStep { return breakerStep{op: "allow", allowed: allowed} }
+func okStep() breakerStep                { return breakerStep{op: "record"} }
+func failStep() breakerStep              { return breakerStep{op: "record", err: ErrBadConn} }
+func slowStep() breakerStep              { return breakerStep{op: "record", latency: time.Second} }
+func cancelStep() breakerStep            { return breakerStep{op: "cancel"} }
+func waitStep() breakerStep              { return breakerStep{op: "wait"} }
+
+func TestBreakerTransitions(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []breakerStep
+		want  BreakerState
+		// 依次发生的状态变化
+		changes []BreakerState
+	}{
+		{"below min requests", []breakerStep{failStep(), failStep(), failStep()}, BreakerState_Closed, nil},
+		{"below error rate", []breakerStep{okStep(), okStep(), okStep(), failStep()}, BreakerState_Closed, nil},
+		{"error rate", []breakerStep{okStep(), okStep(), failStep(), failStep(), allowStep(false)},
+			BreakerState_Open, []BreakerState{BreakerState_Open}},
+		{"slow rate", []breakerStep{okStep(), okStep(), slowStep(), slowStep()},
+			BreakerState_Open, []BreakerState{BreakerState_Open}},
+		{"half open after timeout", []breakerStep{failStep(), failStep(), failStep(), failStep(), waitStep(), allowStep(true)},
+			BreakerState_HalfOpen, []BreakerState{BreakerState_Open, BreakerState_HalfOpen}},
+		{"half open limits probes", []breakerStep{failStep(), failStep(), failStep(), failStep(), waitStep(),
+			allowStep(true), allowStep(true), allowStep(false)},
+			BreakerState_HalfOpen, []BreakerState{BreakerState_Open, BreakerState_HalfOpen}},
+		{"probes succeed", []breakerStep{failStep(), failStep(), failStep(), failStep(), waitStep(),
+			allowStep(true), allowStep(true), okStep(), okStep(), allowStep(true)},
+			BreakerState_Closed, []BreakerState{BreakerState_Open, BreakerState_HalfOpen, BreakerState_Closed}},
+		{"probe fails", []breakerStep{failStep(), failStep(), failStep(), failStep(), waitStep(),
+			allowStep(true), failStep(), allowStep(false)},
+			BreakerState_Open, []BreakerState{BreakerState_Open, BreakerState_HalfOpen, BreakerState_Open}},
+		{"slow probe", []breakerStep{failStep(), failStep(), failStep(), failStep(), waitStep(),
+			allowStep(true), slowStep()},
+			BreakerState_Open, []BreakerState{BreakerState_Open, BreakerState_HalfOpen, BreakerState_Open}},
+		{"cancelled probe is returned", []breakerStep{failStep(), failStep(), failStep(), failStep(), waitStep(),
+			allowStep(true), allowStep(true), cancelStep(), cancelStep(), allowStep(true), allowStep(true), allowStep(false)},
+			BreakerState_HalfOpen, []BreakerState{BreakerState_Open, BreakerState_HalfOpen}},
+		{"closed resets counters", []breakerStep{failStep(), failStep(), failStep(), failStep(), waitStep(),
+			allowStep(true), allowStep(true), okStep(), okStep(), failStep(), failStep(), failStep()},
+			BreakerState_Closed, []BreakerState{BreakerState_Open, BreakerState_HalfOpen, BreakerState_Closed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []BreakerState
+			b := newBreaker(newTestBreakerConf(), func(from, to BreakerState) {
+				changes = append(changes, to)
+			})
+			for i, step := range tt.steps {
+				switch step.op {
+				case "allow":
+					if got := b.allow(); got != step.allowed {
+						t.Fatalf("step %d: allow = %v, want %v", i, got, step.allowed)
+					}
+				case "record":
+					b.record(step.err, step.latency)
+				case "cancel":
+					b.cancel()
+				case "wait":
+					time.Sleep(testOpenTimeout)
+				}
+			}
+			if b.state != tt.want {
+				t.Fatalf("state = %s, want %s", b.state, tt.want)
+			}
+			if len(changes) != len(tt.changes) {
+				t.Fatalf("changes = %v, want %v", changes, tt.changes)
+			}
+			for i := range changes {
+				if changes[i] != tt.changes[i] {
+					t.Fatalf("changes = %v, want %v", changes, tt.changes)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerWindowReset(t *testing.T) {
+	cfg := newTestBreakerConf()
+	cfg.Window = 20 * time.Millisecond
+	b := newBreaker(cfg, nil)
+	b.record(ErrBadConn, 0)
+	b.record(ErrBadConn, 0)
+	b.record(ErrBadConn, 0)
+	time.Sleep(cfg.Window + 5*time.Millisecond)
+	// 新窗口内请求数不足，不熔断
+	b.record(ErrBadConn, 0)
+	if b.state != BreakerState_Closed {
+		t.Fatalf("state = %s, want closed", b.state)
+	}
+}
+
+func TestIsBreakerFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"bad conn", ErrBadConn, true},
+		{"wrapped bad conn", errors.Join(context.Canceled, ErrBadConn), true},
+		{"server error", errors2.NewError("hello", 503, "server overloaded"), true},
+		{"business error", errors2.NewError("hello", 1001, "user not found"), false},
+		{"client error", errors2.NewError("hello", 404, "not found"), false},
+		{"other error", errors.New("oops"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBreakerFailure(tt.err); got != tt.want {
+				t.Fatalf("isBreakerFailure(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,21 +2,41 @@ package civet
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	errors2 "github.com/YCloud/civet/errors"
 	"github.com/YCloud/civet/internal/config"
 	"github.com/YCloud/civet/meta"
+	"github.com/YCloud/civet/tlog"
+	"io"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var ErrBadConn = errors.New("bad connection")
 
+// dialTimeout 建立 tcp 连接的超时，不包含 TLS 握手
+const dialTimeout = 3 * time.Second
+
+// Watch 失败后重试的退避时间
+const (
+	resolverMinBackoff = 500 * time.Millisecond
+	resolverMaxBackoff = 30 * time.Second
+)
+
+// clients 所有未关闭的 Client，用于指标与管理接口
+var clients sync.Map
+
 type clientCallOptions struct {
-	enc Encoder
+	enc         Encoder
+	retryPolicy *RetryPolicy
+	idempotent  bool
+	hedgePolicy *HedgePolicy
 }
 
 type ClientCallOption func(*clientCallOptions)
@@ -41,6 +61,20 @@ func WithClientOptionEndpoint(endpoints ...*Endpoint) ClientOption {
 	}
 }
 
+// WithClientBalancer 指定负载均衡，默认使用配置中的 balancer
+func WithClientBalancer(balancer Balancer) ClientOption {
+	return func(client *Client) {
+		client.balancer = balancer
+	}
+}
+
+// WithClientResolver 通过服务发现获取节点，节点变化时自动更新连接池
+func WithClientResolver(resolver Resolver) ClientOption {
+	return func(client *Client) {
+		client.resolver = resolver
+	}
+}
+
 func WithClientInterceptors(interceptors ...ClientInterceptor) ClientOption {
 	return func(client *Client) {
 		client.interceptors = append(client.interceptors, interceptors...)
@@ -48,30 +82,80 @@ func WithClientInterceptors(interceptors ...ClientInterceptor) ClientOption {
 }
 
 type Client struct {
-	mux       sync.Mutex
-	reqId     atomic.Int32
-	service   string
-	endpoints []*Endpoint
-	idx       int
-	enc       Encoder
-	pools     map[string]*clientConnPool
-	reqData   sync.Map
-	recvCh    chan []byte
+	mux     sync.Mutex
+	reqId   atomic.Int32
+	service string
+	// 本进程的服务名，通过 Caller header 告知服务端
+	caller string
+	// 未配置 TLS 时为 nil
+	tls         *tlsReloader
+	credentials Credentials
+	endpoints   []*Endpoint
+	balancer    Balancer
+	enc         Encoder
+	pools       map[string]*clientConnPool
+	reqData     sync.Map
+	streams     sync.Map
+	recvCh      chan []byte
+	resolver    Resolver
+	ctx         context.Context
+	cancel      context.CancelFunc
 
 	cfg *config.ClientConf
 
 	interceptors     []ClientInterceptor
 	unaryInterceptor ClientInterceptor
+
+	pushMux      sync.Mutex
+	pushHandlers map[string]PushHandler
+
+	retryPolicy *RetryPolicy
+	idempotent  map[string]bool
+	retryBudget *retryBudget
+
+	breakers        map[string]*breaker
+	breakerListener BreakerListener
+
+	hedgePolicies map[string]*HedgePolicy
+	// 每个方法最近的请求耗时，key 为方法名，value 为 *latencyWindow
+	latencies sync.Map
 }
 
 func NewClient(service string, options ...ClientOption) *Client {
 	client := &Client{
-		service:      service,
-		endpoints:    make([]*Endpoint, 0),
-		pools:        make(map[string]*clientConnPool),
-		recvCh:       make(chan []byte, 10000),
-		interceptors: make([]ClientInterceptor, 0),
-		cfg:          config.GetClientConf(),
+		service:       service,
+		endpoints:     make([]*Endpoint, 0),
+		pools:         make(map[string]*clientConnPool),
+		recvCh:        make(chan []byte, 10000),
+		interceptors:  make([]ClientInterceptor, 0),
+		pushHandlers:  make(map[string]PushHandler),
+		idempotent:    make(map[string]bool),
+		breakers:      make(map[string]*breaker),
+		hedgePolicies: make(map[string]*HedgePolicy),
+		cfg:           config.GetClientConf(),
+		caller:        serviceName(config.GetConfig()),
+	}
+	budgetPercent := config.DefaultRetryBudgetPercent
+	if retryCfg := client.cfg.Retry; retryCfg != nil {
+		client.retryPolicy = newRetryPolicy(retryCfg)
+		for _, method := range retryCfg.IdempotentMethods {
+			client.idempotent[method] = true
+		}
+		budgetPercent = retryCfg.BudgetPercent
+	}
+	client.retryBudget = newRetryBudget(budgetPercent)
+	if client.cfg.TLS != nil {
+		reloader, err := newTLSReloader(client.cfg.TLS)
+		if err != nil {
+			panic(err)
+		}
+		client.tls = reloader
+	}
+	if client.cfg.Credentials != nil {
+		client.credentials = newCredentialsFromConf(client.cfg.Credentials)
+	}
+	for method, hedgeCfg := range client.cfg.Hedge {
+		client.hedgePolicies[method] = newHedgePolicy(hedgeCfg)
 	}
 
 	for _, option := range options {
@@ -82,17 +166,134 @@ func NewClient(service string, options ...ClientOption) *Client {
 		client.enc = GetEncoder(client.cfg.EncoderName)
 	}
 
-	client.unaryInterceptor = buildClientInterceptor(client.interceptors...)
+	if client.balancer == nil {
+		balancer, err := NewBalancer(client.cfg.Balancer, client.cfg.HashKey)
+		if err != nil {
+			panic(err)
+		}
+		client.balancer = balancer
+	}
+	client.balancer.Update(client.endpoints)
+
+	client.unaryInterceptor = buildClientInterceptor(client.service, client.interceptors...)
 	for _, endpoint := range client.endpoints {
 		ipport := endpoint.IPPort()
 		client.pools[ipport] = newClientConnPool(client, ipport, client.cfg.MaxConnNum)
 	}
 
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	if client.resolver != nil {
+		client.watchResolver()
+	}
+
 	go client.recvProcess()
+	clients.Store(client, struct{}{})
 
 	return client
 }
 
+// Close 停止服务发现并关闭所有连接
+func (client *Client) Close() {
+	clients.Delete(client)
+	client.cancel()
+	client.mux.Lock()
+	pools := client.pools
+	client.pools = make(map[string]*clientConnPool)
+	client.endpoints = make([]*Endpoint, 0)
+	client.mux.Unlock()
+	for _, pool := range pools {
+		pool.close()
+	}
+}
+
+// watchResolver 首次 Watch 成功时在返回前应用首次解析的结果；失败时在后台按退避重试，直到 Close
+func (client *Client) watchResolver() {
+	ch, err := client.resolver.Watch(client.ctx, client.service)
+	if err != nil {
+		tlog.Error("resolver watch error", tlog.Any("service", client.service), tlog.Any("err", err))
+		go client.rewatchResolver()
+		return
+	}
+	// 首次解析的结果在 NewClient 返回前生效
+	for drained := false; !drained; {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				go client.rewatchResolver()
+				return
+			}
+			client.applyResolverEvent(ev)
+		default:
+			drained = true
+		}
+	}
+	go func() {
+		for ev := range ch {
+			client.applyResolverEvent(ev)
+		}
+		client.rewatchResolver()
+	}()
+}
+
+// rewatchResolver Watch 失败或 chan 在 Close 之前被关闭时重新 Watch，退避时间从 resolverMinBackoff 翻倍到 resolverMaxBackoff
+func (client *Client) rewatchResolver() {
+	backoff := resolverMinBackoff
+	for {
+		timer := time.NewTimer(backoff)
+		select {
+		case <-client.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		ch, err := client.resolver.Watch(client.ctx, client.service)
+		if err != nil {
+			tlog.Error("resolver watch error", tlog.Any("service", client.service), tlog.Any("err", err), tlog.Any("backoff", backoff))
+			if backoff *= 2; backoff > resolverMaxBackoff {
+				backoff = resolverMaxBackoff
+			}
+			continue
+		}
+		backoff = resolverMinBackoff
+		for ev := range ch {
+			client.applyResolverEvent(ev)
+		}
+	}
+}
+
+func (client *Client) applyResolverEvent(ev *ResolverEvent) {
+	ipport := ev.Endpoint.IPPort()
+	client.mux.Lock()
+	var removed *clientConnPool
+	switch ev.Type {
+	case ResolverEvent_Add:
+		if _, ok := client.pools[ipport]; !ok {
+			client.pools[ipport] = newClientConnPool(client, ipport, client.cfg.MaxConnNum)
+		}
+	case ResolverEvent_Remove:
+		removed = client.pools[ipport]
+		delete(client.pools, ipport)
+		delete(client.breakers, ipport)
+	}
+	endpoints := make([]*Endpoint, 0, len(client.endpoints)+1)
+	for _, endpoint := range client.endpoints {
+		if endpoint.IPPort() != ipport {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	if ev.Type == ResolverEvent_Add {
+		endpoints = append(endpoints, ev.Endpoint)
+	}
+	client.endpoints = endpoints
+	client.balancer.Update(endpoints)
+	client.mux.Unlock()
+
+	tlog.Info("resolver endpoint changed", tlog.Any("service", client.service), tlog.Any("type", ev.Type), tlog.Any("endpoint", ipport))
+	if removed != nil {
+		removed.close()
+	}
+}
+
 func (client *Client) Call(ctx context.Context, method string, ipport string, req, rsp any, options ...ClientCallOption) error {
 	callOptions := &clientCallOptions{}
 	for _, option := range options {
@@ -114,48 +315,89 @@ func (client *Client) Call(ctx context.Context, method string, ipport string, re
 	}
 	reqHeader = meta.CopyHeader(reqHeader)
 	reqHeader[meta.ContentType] = enc.Name()
+	reqHeader[meta.Caller] = client.caller
+	// 所有请求都存入令牌，重试的比例按总请求数计算
+	client.retryBudget.deposit()
+
+	if hedge := client.getHedgePolicy(method, ipport, rsp, callOptions); hedge != nil {
+		return client.hedgeCall(ctx, method, reqHeader, reqBytes, enc, rsp, hedge)
+	}
+
+	policy := client.getRetryPolicy(method, callOptions)
+	if policy == nil {
+		return client.invoke(ctx, ipport, client.newRequest(method, reqHeader, reqBytes), enc, rsp)
+	}
+
+	ctx = withTriedEndpoints(ctx)
+	for attempt := 1; ; attempt++ {
+		err = client.invoke(ctx, ipport, client.newRequest(method, reqHeader, reqBytes), enc, rsp)
+		if err == nil || attempt >= policy.MaxAttempts || !policy.retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if !client.retryBudget.withdraw() {
+			return err
+		}
+		if sleepContext(ctx, policy.backoff(attempt)) != nil {
+			return err
+		}
+	}
+}
 
-	reqMsg := &Request{
+// newRequest 每次尝试使用新的 StreamId 与 header 副本
+func (client *Client) newRequest(method string, reqHeader map[string]string, body []byte) *Request {
+	return &Request{
 		StreamId: client.reqId.Add(1),
 		Flag:     MessageFlag_Req,
 		Route:    client.getRoute(method),
-		Header:   reqHeader,
-		Body:     reqBytes,
+		Header:   meta.CopyHeader(reqHeader),
+		Body:     body,
 	}
+}
 
+func (client *Client) invoke(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any) error {
 	interceptorFun := client.unaryInterceptor
 	if interceptorFun != nil {
-		err = interceptorFun(ctx, ipport, reqMsg, enc, rsp, client.invoker)
-	} else {
-		err = client.invoker(ctx, ipport, reqMsg, enc, rsp)
+		return interceptorFun(ctx, ipport, reqMsg, enc, rsp, client.invoker)
 	}
-	return err
+	return client.invoker(ctx, ipport, reqMsg, enc, rsp)
 }
 
-func (client *Client) invoker(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any) error {
-	clientConn, err := client.getConn(ctx, ipport)
+func (client *Client) invoker(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any) (err error) {
+	if err := setTimeoutHeader(ctx, reqMsg.Header); err != nil {
+		return err
+	}
+	if err := client.applyCredentials(reqMsg); err != nil {
+		return err
+	}
+	clientConn, done, err := client.getConn(ctx, ipport, reqMsg)
 	if err != nil {
 		return err
 	}
+	defer func() {
+		done(err)
+	}()
 	reqMsgBytes, err := MarshalRequest(reqMsg)
 	if err != nil {
 		return err
 	}
-	rspChan := make(chan *Response, 1)
-	client.reqData.Store(reqMsg.StreamId, rspChan)
+	call := &pendingCall{
+		conn:    clientConn,
+		rspChan: make(chan *Response, 1),
+	}
+	client.reqData.Store(reqMsg.StreamId, call)
 	defer client.reqData.Delete(reqMsg.StreamId)
-	defer close(rspChan)
 
 	_, err = clientConn.conn.Write(reqMsgBytes)
 	if err != nil {
-		fmt.Println(err)
+		clientConn.close()
 		return err
 	}
 
 	select {
 	case <-ctx.Done():
+		clientConn.sendCancel(reqMsg.StreamId)
 		return errors2.ErrRequestTimeout
-	case rspMsg := <-rspChan:
+	case rspMsg := <-call.rspChan:
 		err = nil
 		if rspMsg.Code > 0 && len(rspMsg.CodeDesc) > 0 {
 			err = errors2.NewError(client.service, rspMsg.Code, rspMsg.CodeDesc)
@@ -171,9 +413,120 @@ func (client *Client) invoker(ctx context.Context, ipport string, reqMsg *Reques
 	}
 }
 
+// NewStream 打开一个流，ctx 取消后流随之结束
+func (client *Client) NewStream(ctx context.Context, method string, ipport string, options ...ClientCallOption) (ClientStream, error) {
+	callOptions := &clientCallOptions{}
+	for _, option := range options {
+		option(callOptions)
+	}
+
+	reqHeader, ok := meta.FromMetaContextReqContext(ctx)
+	if !ok {
+		reqHeader = make(map[string]string)
+	}
+	enc, err := client.getEncoder(callOptions, reqHeader)
+	if err != nil {
+		return nil, err
+	}
+	window := client.cfg.StreamWindow
+	reqHeader = meta.CopyHeader(reqHeader)
+	reqHeader[meta.ContentType] = enc.Name()
+	reqHeader[meta.Caller] = client.caller
+	reqHeader[meta.StreamWindow] = strconv.Itoa(int(window))
+	if err := setTimeoutHeader(ctx, reqHeader); err != nil {
+		return nil, err
+	}
+	openMsg := &Request{
+		StreamId: client.reqId.Add(1),
+		Flag:     MessageFlag_StreamOpen,
+		Route:    client.getRoute(method),
+		Header:   reqHeader,
+	}
+	// 流不经过拦截器，span 与指标覆盖流的整个生命周期
+	start := time.Now()
+	ctx, span := startClientSpan(ctx, ipport, openMsg)
+	// fail 流建立失败时结束 span 并记录指标
+	fail := func(err error) (ClientStream, error) {
+		span.End(err)
+		observeClientRequest(client.service, openMsg.Route, start, err)
+		return nil, err
+	}
+	if err := client.applyCredentials(openMsg); err != nil {
+		return fail(err)
+	}
+	openBytes, err := MarshalRequest(openMsg)
+	if err != nil {
+		return fail(err)
+	}
+	clientConn, done, err := client.getConn(ctx, ipport, openMsg)
+	if err != nil {
+		return fail(err)
+	}
+
+	streamId := openMsg.StreamId
+	ctx, cancel := context.WithCancel(ctx)
+	st := newStream(ctx, cancel, streamId, enc, window, func(flag MessageFlag, body []byte) error {
+		bs, err := MarshalRequest(&Request{StreamId: streamId, Flag: flag, Body: body})
+		if err != nil {
+			return err
+		}
+		_, err = clientConn.conn.Write(bs)
+		return err
+	})
+	client.streams.Store(streamId, &clientStream{stream: st, conn: clientConn})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if !st.isDone() {
+				clientConn.sendCancel(streamId)
+			}
+		case <-st.done:
+		}
+		err := st.err()
+		span.End(err)
+		observeClientRequest(client.service, openMsg.Route, start, err)
+		// 流结束后释放派生 ctx 的资源
+		cancel()
+		client.streams.Delete(streamId)
+		done(nil)
+	}()
+
+	if _, err = clientConn.conn.Write(openBytes); err != nil {
+		st.finish(err)
+		cancel()
+		return nil, err
+	}
+	return st, nil
+}
+
+func (client *Client) handleStream(rspMsg *Response) {
+	val, ok := client.streams.Load(rspMsg.StreamId)
+	if !ok {
+		return
+	}
+	st := val.(*clientStream).stream
+	switch rspMsg.Flag {
+	case MessageFlag_StreamData:
+		if !st.push(rspMsg.Body) {
+			st.finish(ErrStreamWindow)
+			st.cancel()
+		}
+	case MessageFlag_StreamWindow:
+		st.addCredit(parseWindow(rspMsg.Body))
+	case MessageFlag_StreamClose:
+		var err error = io.EOF
+		if rspMsg.Code > 0 || len(rspMsg.CodeDesc) > 0 {
+			err = errors2.NewError(client.service, rspMsg.Code, rspMsg.CodeDesc)
+		}
+		st.finish(err)
+	}
+}
+
 func (client *Client) recvProcess() {
 	for {
 		select {
+		case <-client.ctx.Done():
+			return
 		case bs := <-client.recvCh:
 			rspMsg, err := ParserResponse(bs)
 			if err != nil {
@@ -182,8 +535,12 @@ func (client *Client) recvProcess() {
 			switch rspMsg.Flag {
 			case MessageFlag_Resp:
 				if val, ok := client.reqData.Load(rspMsg.StreamId); ok {
-					val.(chan *Response) <- rspMsg
+					val.(*pendingCall).done(rspMsg)
 				}
+			case MessageFlag_Push:
+				client.handlePush(rspMsg)
+			case MessageFlag_StreamData, MessageFlag_StreamWindow, MessageFlag_StreamClose:
+				client.handleStream(rspMsg)
 			}
 		}
 	}
@@ -207,31 +564,102 @@ func (client *Client) getRoute(method string) string {
 	return fmt.Sprintf("%s/%s", client.service, method)
 }
 
-func (client *Client) getConn(ctx context.Context, ipport string) (*clientConn, error) {
-	client.mux.Lock()
-	defer client.mux.Unlock()
-
+// getConn ipport 为空时通过负载均衡选择节点，连接失败的节点在本次选择中跳过；done 在请求结束时调用
+func (client *Client) getConn(ctx context.Context, ipport string, reqMsg *Request) (*clientConn, func(error), error) {
 	if len(ipport) != 0 {
-		pool, ok := client.pools[ipport]
+		pool, ok := client.getPool(ipport)
 		if !ok {
-			return nil, ErrBadConn
-		}
-		return pool.get()
-	} else {
-		for i := 0; i < 3; i++ {
-			endpoint := client.endpoints[client.idx%len(client.endpoints)]
-			client.idx++
-
-			pool, ok := client.pools[endpoint.IPPort()]
-			if ok {
-				conn, err := pool.get()
-				if err == nil {
-					return conn, nil
+			return nil, nil, ErrBadConn
+		}
+		conn, err := pool.get()
+		return conn, noopDone, err
+	}
+
+	tried := triedFromContext(ctx)
+	// 连接失败或熔断的节点，本次选择中一定跳过
+	unavailable := make(map[string]bool)
+	breakerOpen := false
+	info := &PickInfo{Ctx: ctx, Request: reqMsg, Exclude: tried.exclude()}
+	for i := 0; i < 3; {
+		endpoint, done, err := client.balancer.Pick(info)
+		if errors.Is(err, ErrNoEndpoint) && len(info.Exclude) > len(unavailable) {
+			// 之前尝试过的节点只是尽量避开，没有其他节点时仍然可以选择
+			info.Exclude = make(map[string]bool)
+			for addr := range unavailable {
+				info.Exclude[addr] = true
+			}
+			endpoint, done, err = client.balancer.Pick(info)
+		}
+		if err != nil {
+			if errors.Is(err, ErrNoEndpoint) && breakerOpen {
+				return nil, nil, ErrBreakerOpen
+			}
+			if errors.Is(err, ErrNoEndpoint) && i > 0 {
+				break
+			}
+			return nil, nil, err
+		}
+		ipport = endpoint.IPPort()
+		info.Exclude[ipport] = true
+		unavailable[ipport] = true
+
+		br := client.getBreaker(ipport)
+		if br != nil && !br.allow() {
+			done(ErrBreakerOpen)
+			breakerOpen = true
+			continue
+		}
+		i++
+		if pool, ok := client.getPool(ipport); ok {
+			conn, err := pool.get()
+			if err == nil {
+				tried.add(ipport)
+				if br != nil {
+					start, balancerDone := time.Now(), done
+					done = func(err error) {
+						balancerDone(err)
+						// 主动取消的请求（如对冲请求中落后的一方）不计入熔断统计
+						if errors.Is(ctx.Err(), context.Canceled) {
+							br.cancel()
+						} else {
+							br.record(err, time.Since(start))
+						}
+					}
 				}
+				return conn, done, nil
 			}
 		}
+		done(ErrBadConn)
+		if br != nil {
+			br.record(ErrBadConn, 0)
+		}
+	}
+	return nil, nil, ErrBadConn
+}
+
+func (client *Client) getPool(ipport string) (*clientConnPool, bool) {
+	client.mux.Lock()
+	defer client.mux.Unlock()
+	pool, ok := client.pools[ipport]
+	return pool, ok
+}
+
+// pendingCall 等待响应的请求
+type pendingCall struct {
+	conn    *clientConn
+	rspChan chan *Response
+}
+
+func (call *pendingCall) done(rspMsg *Response) {
+	select {
+	case call.rspChan <- rspMsg:
+	default:
 	}
-	return nil, ErrBadConn
+}
+
+type clientStream struct {
+	*stream
+	conn *clientConn
 }
 
 type clientConnPool struct {
@@ -241,6 +669,10 @@ type clientConnPool struct {
 	conn       []*clientConn
 	idx        int
 	maxConnNum int // 最大连接数
+	closed     bool
+	// 正在拨号的连接数，拨号结束时通过 dialed 通知等待的协程
+	dialing int
+	dialed  *sync.Cond
 }
 
 func newClientConnPool(client *Client, addr string, maxConnNum int) *clientConnPool {
@@ -250,6 +682,7 @@ func newClientConnPool(client *Client, addr string, maxConnNum int) *clientConnP
 		conn:       make([]*clientConn, 0, maxConnNum),
 		maxConnNum: maxConnNum,
 	}
+	pool.dialed = sync.NewCond(&pool.mux)
 	return pool
 }
 
@@ -257,8 +690,13 @@ func (pool *clientConnPool) get() (*clientConn, error) {
 	pool.mux.Lock()
 	defer pool.mux.Unlock()
 
-	if len(pool.conn) == 0 {
-		pool.tryConnect()
+	// 没有可用连接时等待正在进行的拨号，没有拨号时自己建立连接
+	for len(pool.conn) == 0 && !pool.closed {
+		if pool.dialing == 0 {
+			pool.connect()
+			break
+		}
+		pool.dialed.Wait()
 	}
 
 	if len(pool.conn) == 0 {
@@ -268,44 +706,181 @@ func (pool *clientConnPool) get() (*clientConn, error) {
 	conn := pool.conn[pool.idx%len(pool.conn)]
 	pool.idx++
 
-	if len(pool.conn) < pool.maxConnNum {
-		go pool.tryConnectLocked()
+	if len(pool.conn)+pool.dialing < pool.maxConnNum {
+		go pool.grow()
 	}
 
 	return conn, nil
 }
 
-func (pool *clientConnPool) tryConnectLocked() {
+func (pool *clientConnPool) grow() {
 	pool.mux.Lock()
 	defer pool.mux.Unlock()
-	pool.tryConnect()
+	pool.connect()
 }
 
-func (pool *clientConnPool) tryConnect() {
-	if len(pool.conn) >= pool.maxConnNum {
+// dial 配置了 TLS 时完成握手后返回
+func (client *Client) dial(addr string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil || client.tls == nil {
+		return conn, err
+	}
+	tlsConn := tls.Client(conn, client.tls.clientConfig(addr))
+	if err = handshake(tlsConn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// connect 建立一个连接加入连接池，调用时需持有 pool.mux；拨号与 TLS 握手期间释放锁，不阻塞 get
+func (pool *clientConnPool) connect() {
+	if pool.closed || len(pool.conn)+pool.dialing >= pool.maxConnNum {
 		return
 	}
-	conn, err := net.Dial("tcp", pool.addr)
+	pool.dialing++
+	pool.mux.Unlock()
+	conn, err := pool.client.dial(pool.addr)
+	pool.mux.Lock()
+	pool.dialing--
+	pool.dialed.Broadcast()
 	if err != nil {
 		fmt.Println("连接失败", err)
 		return
 	}
-	c := newClientConn(conn, pool.client)
+	if pool.closed {
+		conn.Close()
+		return
+	}
+	c := newClientConn(newCountingConn(conn, clientBytesReceived.With(pool.client.service), clientBytesSent.With(pool.client.service)), pool)
 	go c.recv()
+	go c.keepalive()
 	pool.conn = append(pool.conn, c)
 }
 
+func (pool *clientConnPool) close() {
+	pool.mux.Lock()
+	conns := pool.conn
+	pool.conn = make([]*clientConn, 0, pool.maxConnNum)
+	pool.closed = true
+	pool.dialed.Broadcast()
+	pool.mux.Unlock()
+	for _, c := range conns {
+		c.close()
+	}
+}
+
+func (pool *clientConnPool) remove(c *clientConn) {
+	pool.mux.Lock()
+	defer pool.mux.Unlock()
+	for i, conn := range pool.conn {
+		if conn == c {
+			pool.conn = append(pool.conn[:i], pool.conn[i+1:]...)
+			return
+		}
+	}
+}
+
 type clientConn struct {
-	client *Client
-	conn   net.Conn
+	client    *Client
+	pool      *clientConnPool
+	conn      net.Conn
+	lastRecv  atomic.Int64
+	missed    atomic.Int32
+	isClose   atomic.Bool
+	closeChan chan struct{}
 }
 
-func newClientConn(conn net.Conn, client *Client) *clientConn {
-	c := &clientConn{conn: conn, client: client}
+func newClientConn(conn net.Conn, pool *clientConnPool) *clientConn {
+	c := &clientConn{
+		conn:      conn,
+		client:    pool.client,
+		pool:      pool,
+		closeChan: make(chan struct{}),
+	}
+	c.lastRecv.Store(time.Now().UnixNano())
 	return c
 }
 
+// close 关闭连接并从连接池中移除，该连接上等待中的请求和流立即失败
+func (c *clientConn) close() {
+	if c.isClose.Swap(true) {
+		return
+	}
+	c.conn.Close()
+	close(c.closeChan)
+	c.pool.remove(c)
+
+	client := c.client
+	client.reqData.Range(func(key, value any) bool {
+		call := value.(*pendingCall)
+		if call.conn == c {
+			call.done(&Response{
+				StreamId: key.(int32),
+				Flag:     MessageFlag_Resp,
+				Code:     503,
+				CodeDesc: "connection closed",
+			})
+		}
+		return true
+	})
+	client.streams.Range(func(key, value any) bool {
+		if st := value.(*clientStream); st.conn == c {
+			st.finish(ErrBadConn)
+		}
+		return true
+	})
+}
+
+// goAway 服务端即将关闭，连接从连接池中移除不再用于新请求，等待服务端关闭连接
+func (c *clientConn) goAway() {
+	tlog.Info("connection go away", tlog.Any("service", c.client.service), tlog.Any("addr", c.pool.addr))
+	c.pool.remove(c)
+}
+
+// sendCancel 通知服务端取消请求或流，发送失败时忽略
+func (c *clientConn) sendCancel(streamId int32) {
+	if c.isClose.Load() {
+		return
+	}
+	bs, _ := MarshalRequest(&Request{StreamId: streamId, Flag: MessageFlag_Cancel})
+	c.conn.Write(bs)
+}
+
+// keepalive 连接空闲时定时发送 ping，连续 PingMaxMiss 次没有收到任何数据则关闭连接
+func (c *clientConn) keepalive() {
+	cfg := c.client.cfg
+	if cfg.PingInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.closeChan:
+			return
+		case <-ticker.C:
+			if time.Since(time.Unix(0, c.lastRecv.Load())) < cfg.PingInterval {
+				continue
+			}
+			if c.missed.Add(1) > cfg.PingMaxMiss {
+				tlog.Warn("connection ping timeout", tlog.Any("service", c.client.service), tlog.Any("addr", c.pool.addr))
+				c.close()
+				return
+			}
+			bs, _ := MarshalRequest(&Request{StreamId: c.client.reqId.Add(1), Flag: MessageFlag_Ping})
+			if _, err := c.conn.Write(bs); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
 func (c *clientConn) recv() {
+	defer c.close()
+
 	buf := make([]byte, 8192)
 	currentBuf := make([]byte, 0, 8192)
 	for {
@@ -313,6 +888,8 @@ func (c *clientConn) recv() {
 		if err != nil {
 			return
 		}
+		c.lastRecv.Store(time.Now().UnixNano())
+		c.missed.Store(0)
 		currentBuf = append(currentBuf, buf[:n]...)
 		for {
 			body, n, stat := c.readBody(currentBuf)
@@ -320,6 +897,10 @@ func (c *clientConn) recv() {
 				break
 			} else if stat == ReadStat_Full {
 				currentBuf = currentBuf[n:]
+				if MessageFlag(body[4]&MessageFlagMask) == MessageFlag_GoAway {
+					c.goAway()
+					continue
+				}
 				c.client.recvCh <- body
 			} else {
 				return
@@ -0,0 +1,327 @@
+// civet-gen 根据 Go 接口定义生成 civet 的 Dispatch 函数与强类型客户端
+//
+// 接口中的每个方法签名必须为 func(ctx context.Context, req *Req) (*Resp, error)
+//
+//	//go:generate civet-gen -type HelloService
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const civetImportPath = "github.com/YCloud/civet"
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of interface names; empty means all interfaces in the file")
+	output    = flag.String("output", "", "output file name; default <file>_civet.go")
+)
+
+type method struct {
+	Name     string
+	ReqType  string
+	RespType string
+}
+
+type service struct {
+	Name    string
+	Methods []*method
+}
+
+type file struct {
+	Package  string
+	Imports  []string
+	Services []*service
+}
+
+func main() {
+	log := func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, "civet-gen: "+format+"\n", args...)
+		os.Exit(1)
+	}
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: civet-gen [-type Name[,Name]] [-output file] [file.go]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	src := flag.Arg(0)
+	if src == "" {
+		src = os.Getenv("GOFILE")
+	}
+	if src == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var names []string
+	if *typeNames != "" {
+		names = strings.Split(*typeNames, ",")
+	}
+	f, err := parseFile(src, names)
+	if err != nil {
+		log("%v", err)
+	}
+	code, err := generate(f)
+	if err != nil {
+		log("%v", err)
+	}
+
+	out := *output
+	if out == "" {
+		out = strings.TrimSuffix(src, ".go") + "_civet.go"
+	}
+	if err = os.WriteFile(out, code, 0644); err != nil {
+		log("%v", err)
+	}
+}
+
+func parseFile(path string, names []string) (*file, error) {
+	fset := token.NewFileSet()
+	astFile, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[strings.TrimSpace(name)] = true
+	}
+
+	// 源文件中的 import，key 为包名
+	imports := make(map[string]string)
+	for _, spec := range astFile.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		name, imp := importName(p, filepath.Dir(path)), spec.Path.Value
+		if spec.Name != nil {
+			name = spec.Name.Name
+			imp = name + " " + imp
+		}
+		imports[name] = imp
+	}
+
+	f := &file{Package: astFile.Name.Name}
+	used := map[string]bool{}
+	for _, decl := range astFile.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			it, ok := ts.Type.(*ast.InterfaceType)
+			if !ok {
+				continue
+			}
+			if len(wanted) > 0 && !wanted[ts.Name.Name] {
+				continue
+			}
+			svc, err := parseService(fset, ts.Name.Name, it, used)
+			if err != nil {
+				return nil, err
+			}
+			delete(wanted, ts.Name.Name)
+			f.Services = append(f.Services, svc)
+		}
+	}
+	for name := range wanted {
+		return nil, fmt.Errorf("interface %s not found in %s", name, path)
+	}
+	if len(f.Services) == 0 {
+		return nil, fmt.Errorf("no interface found in %s", path)
+	}
+
+	for pkg := range used {
+		imp, ok := imports[pkg]
+		if !ok {
+			return nil, fmt.Errorf("import of package %s not found in %s", pkg, path)
+		}
+		f.Imports = append(f.Imports, imp)
+	}
+	sort.Strings(f.Imports)
+	return f, nil
+}
+
+// importName 源文件中 import 的包名，优先通过 go/build 读取包的真实名称，
+// 无法加载时去掉 gopkg.in/yaml.v3 与 /v2 这类路径中的版本后缀
+func importName(path, dir string) string {
+	if pkg, err := build.Import(path, dir, 0); err == nil && pkg.Name != "" {
+		return pkg.Name
+	}
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorVersion(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.LastIndex(name, ".v"); i > 0 && isMajorVersion(name[i+1:]) {
+		name = name[:i]
+	}
+	return name
+}
+
+// isMajorVersion s 形如 v2、v3
+func isMajorVersion(s string) bool {
+	if len(s) < 2 || s[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(s[1:])
+	return err == nil
+}
+
+func parseService(fset *token.FileSet, name string, it *ast.InterfaceType, used map[string]bool) (*service, error) {
+	svc := &service{Name: name}
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interface is not supported", fset.Position(field.Pos()))
+		}
+		m, err := parseMethod(fset, field.Names[0].Name, ft, used)
+		if err != nil {
+			return nil, err
+		}
+		svc.Methods = append(svc.Methods, m)
+	}
+	if len(svc.Methods) == 0 {
+		return nil, fmt.Errorf("interface %s has no method", name)
+	}
+	return svc, nil
+}
+
+func parseMethod(fset *token.FileSet, name string, ft *ast.FuncType, used map[string]bool) (*method, error) {
+	pos := fset.Position(ft.Pos())
+	params := flatten(ft.Params)
+	results := flatten(ft.Results)
+	if len(params) != 2 || len(results) != 2 {
+		return nil, fmt.Errorf("%s: %s must be func(context.Context, *Req) (*Resp, error)", pos, name)
+	}
+	if exprString(fset, params[0]) != "context.Context" {
+		return nil, fmt.Errorf("%s: first parameter of %s must be context.Context", pos, name)
+	}
+	if exprString(fset, results[1]) != "error" {
+		return nil, fmt.Errorf("%s: last result of %s must be error", pos, name)
+	}
+	req, ok := params[1].(*ast.StarExpr)
+	if !ok {
+		return nil, fmt.Errorf("%s: request of %s must be a pointer", pos, name)
+	}
+	resp, ok := results[0].(*ast.StarExpr)
+	if !ok {
+		return nil, fmt.Errorf("%s: response of %s must be a pointer", pos, name)
+	}
+	for _, expr := range []ast.Expr{req.X, resp.X} {
+		if sel, ok := expr.(*ast.SelectorExpr); ok {
+			if pkg, ok := sel.X.(*ast.Ident); ok {
+				used[pkg.Name] = true
+			}
+		}
+	}
+	return &method{
+		Name:     name,
+		ReqType:  exprString(fset, req.X),
+		RespType: exprString(fset, resp.X),
+	}, nil
+}
+
+func flatten(fields *ast.FieldList) []ast.Expr {
+	if fields == nil {
+		return nil
+	}
+	exprs := make([]ast.Expr, 0, len(fields.List))
+	for _, field := range fields.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			exprs = append(exprs, field.Type)
+		}
+	}
+	return exprs
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	buf := bytes.NewBuffer(nil)
+	printer.Fprint(buf, fset, expr)
+	return buf.String()
+}
+
+func generate(f *file) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	if err := tpl.Execute(buf, f); err != nil {
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %v", err)
+	}
+	return code, nil
+}
+
+var tpl = template.Must(template.New("civet").Parse(`// Code generated by civet-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+	"fmt"
+	"` + civetImportPath + `"
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range $svc := .Services}}
+// {{$svc.Name}}Dispatch 作为 civet.AddRPCServant 的 dispatch 参数，impl 需实现 {{$svc.Name}}
+func {{$svc.Name}}Dispatch(ctx context.Context, impl any, enc civet.Encoder, method string, in []byte) ([]byte, error) {
+	obj, ok := impl.({{$svc.Name}})
+	if !ok {
+		return nil, fmt.Errorf("impl %T does not implement {{$svc.Name}}", impl)
+	}
+	switch method {
+{{- range .Methods}}
+	case "{{.Name}}":
+		req := &{{.ReqType}}{}
+		if err := enc.Unmarshal(in, req); err != nil {
+			return nil, err
+		}
+		resp, err := obj.{{.Name}}(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return enc.Marshal(resp)
+{{- end}}
+	default:
+		return nil, fmt.Errorf("%w %s", civet.ErrUnknownMethod, method)
+	}
+}
+
+// {{$svc.Name}}Client {{$svc.Name}} 的强类型客户端
+type {{$svc.Name}}Client struct {
+	client *civet.Client
+}
+
+func New{{$svc.Name}}Client(client *civet.Client) *{{$svc.Name}}Client {
+	return &{{$svc.Name}}Client{client: client}
+}
+{{range .Methods}}
+func (c *{{$svc.Name}}Client) {{.Name}}(ctx context.Context, req *{{.ReqType}}, options ...civet.ClientCallOption) (*{{.RespType}}, error) {
+	resp := &{{.RespType}}{}
+	if err := c.client.Call(ctx, "{{.Name}}", "", req, resp, options...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+{{end}}
+{{- end}}`))
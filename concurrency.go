@@ -0,0 +1,185 @@
+package civet
+
+import (
+	"context"
+	errors2 "errors"
+	"github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/meta"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// gradient 短期与长期耗时的平滑窗口，单位为请求数
+	gradientShortWindow = 10
+	gradientLongWindow  = 600
+	// 每次调整时新估算的并发所占的权重
+	gradientSmoothing = 0.2
+)
+
+// concurrencyLimiter 限制同时处理的请求数，未配置 Concurrency 时上限固定为 MaxRequestNum。
+// gradient 比较短期与长期的平均耗时，耗时升高时按比例减小并发，否则按 sqrt(limit) 增加；
+// aimd 在耗时超过阈值或超时时按比例减小，否则加 1
+type concurrencyLimiter struct {
+	servant  string
+	cfg      *config.ConcurrencyConf
+	maxLimit int32
+
+	inflight atomic.Int32
+	current  atomic.Int32
+
+	mu       sync.Mutex
+	limit    float64
+	shortRtt float64
+	longRtt  float64
+}
+
+func newConcurrencyLimiter(servant string, maxLimit int32, cfg *config.ConcurrencyConf) *concurrencyLimiter {
+	l := &concurrencyLimiter{
+		servant:  servant,
+		cfg:      cfg,
+		maxLimit: maxLimit,
+		limit:    float64(maxLimit),
+	}
+	if cfg != nil {
+		l.limit = float64(cfg.InitialLimit)
+	}
+	l.current.Store(int32(l.limit))
+	return l
+}
+
+// priorityLabel 未知的优先级按 normal 处理
+func priorityLabel(priority string) string {
+	switch priority {
+	case meta.PriorityCritical, meta.PriorityLow:
+		return priority
+	default:
+		return meta.PriorityNormal
+	}
+}
+
+// priorityOf Priority 由客户端设置，只有配置的调用方或路由可以使用 critical，其他按 normal 处理
+func (l *concurrencyLimiter) priorityOf(ctx context.Context, route, priority string) string {
+	priority = priorityLabel(priority)
+	if priority != meta.PriorityCritical {
+		return priority
+	}
+	if l.cfg != nil {
+		if principal, ok := PrincipalFromContext(ctx); ok {
+			for _, name := range l.cfg.CriticalPrincipals {
+				if name == principal.Name {
+					return priority
+				}
+			}
+		}
+		for _, pattern := range l.cfg.CriticalRoutes {
+			if matchRoute(pattern, route) {
+				return priority
+			}
+		}
+	}
+	return meta.PriorityNormal
+}
+
+// limitOf 不同优先级可以使用的并发
+func (l *concurrencyLimiter) limitOf(priority string) int32 {
+	switch priority {
+	case meta.PriorityCritical:
+		return l.maxLimit
+	case meta.PriorityLow:
+		if l.cfg == nil {
+			return l.current.Load()
+		}
+		return int32(math.Max(1, float64(l.current.Load())*l.cfg.LowPriorityRatio))
+	default:
+		return l.current.Load()
+	}
+}
+
+// acquire 超过该优先级可以使用的并发时返回 false
+func (l *concurrencyLimiter) acquire(priority string) bool {
+	limit := l.limitOf(priority)
+	for {
+		n := l.inflight.Load()
+		if n >= limit {
+			return false
+		}
+		if l.inflight.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// acquireContext 按认证后的调用方与路由确定优先级，被拒绝的请求计入 civet_server_shed_total
+func (l *concurrencyLimiter) acquireContext(ctx context.Context) bool {
+	route, _ := meta.RouteFromContext(ctx)
+	header, _ := meta.FromMetaContextReqContext(ctx)
+	priority := l.priorityOf(ctx, route, header[meta.Priority])
+	if !l.acquire(priority) {
+		serverShed.With(l.servant, priority).Inc()
+		return false
+	}
+	return true
+}
+
+// releaseStream 流的存活时间不反映处理能力，只释放并发，不调整上限
+func (l *concurrencyLimiter) releaseStream() {
+	l.inflight.Add(-1)
+}
+
+// release rtt 为请求的处理耗时，dropped 表示请求超时
+func (l *concurrencyLimiter) release(rtt time.Duration, dropped bool) {
+	inflight := float64(l.inflight.Add(-1) + 1)
+	if l.cfg == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch l.cfg.Algorithm {
+	case "aimd":
+		if dropped || rtt > l.cfg.LatencyThreshold {
+			l.limit *= l.cfg.BackoffRatio
+		} else if inflight*2 >= l.limit {
+			l.limit++
+		}
+	default:
+		l.gradient(rtt.Seconds(), inflight)
+	}
+	l.limit = math.Max(float64(l.cfg.MinLimit), math.Min(float64(l.maxLimit), l.limit))
+	l.current.Store(int32(l.limit))
+}
+
+// serverInterceptor 位于认证拦截器之后，超过并发限制时返回 503，客户端可以重试其他节点；
+// 在处理函数返回后释放，请求超时但处理函数仍在执行时继续占用并发
+func (l *concurrencyLimiter) serverInterceptor(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) ([]byte, error) {
+	if !l.acquireContext(ctx) {
+		return nil, errors.ErrServerOverloaded
+	}
+	start := time.Now()
+	defer func() {
+		l.release(time.Since(start), errors2.Is(ctx.Err(), context.DeadlineExceeded))
+	}()
+	return dispatch(ctx, impl, enc, method, in)
+}
+
+func (l *concurrencyLimiter) gradient(rtt, inflight float64) {
+	if l.longRtt == 0 {
+		l.shortRtt, l.longRtt = rtt, rtt
+	}
+	l.shortRtt += (rtt - l.shortRtt) * 2 / (gradientShortWindow + 1)
+	l.longRtt += (rtt - l.longRtt) * 2 / (gradientLongWindow + 1)
+	// 负载下降后让长期耗时更快回落，避免长时间按旧的基线判断
+	if l.longRtt > l.shortRtt*2 {
+		l.longRtt *= 0.95
+	}
+	// 并发没有用到一半时耗时不能反映容量，不调整
+	if inflight < l.limit/2 {
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, l.cfg.Tolerance*l.longRtt/l.shortRtt))
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-gradientSmoothing) + newLimit*gradientSmoothing
+}
@@ -0,0 +1,171 @@
+package civet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/meta"
+)
+
+func newTestConcurrencyConf(initialLimit int) *config.ConcurrencyConf {
+	return &config.ConcurrencyConf{
+		Algorithm:          "aimd",
+		InitialLimit:       initialLimit,
+		MinLimit:           1,
+		LatencyThreshold:   100 * time.Millisecond,
+		BackoffRatio:       0.5,
+		LowPriorityRatio:   0.5,
+		CriticalPrincipals: []string{"ops"},
+		CriticalRoutes:     []string{"hello/Health"},
+	}
+}
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority string
+		// 在 InitialLimit 为 4、MaxRequestNum 为 8 时可以同时持有的数量
+		want int
+	}{
+		{"normal", meta.PriorityNormal, 4},
+		{"empty", "", 4},
+		{"unknown", "urgent", 4},
+		{"low", meta.PriorityLow, 2},
+		{"critical", meta.PriorityCritical, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newConcurrencyLimiter("hello", 8, newTestConcurrencyConf(4))
+			got := 0
+			for l.acquire(tt.priority) {
+				got++
+			}
+			if got != tt.want {
+				t.Fatalf("acquired %d, want %d", got, tt.want)
+			}
+			l.release(time.Millisecond, false)
+			if !l.acquire(tt.priority) {
+				t.Fatal("acquire after release rejected")
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimiterWithoutConf(t *testing.T) {
+	l := newConcurrencyLimiter("hello", 3, nil)
+	for i := 0; i < 3; i++ {
+		if !l.acquire(meta.PriorityLow) {
+			t.Fatalf("acquire %d rejected", i)
+		}
+	}
+	if l.acquire(meta.PriorityCritical) {
+		t.Fatal("acquire over MaxRequestNum accepted")
+	}
+}
+
+func TestConcurrencyLimiterPriorityOf(t *testing.T) {
+	tests := []struct {
+		name      string
+		route     string
+		priority  string
+		principal string
+		want      string
+	}{
+		{"critical from configured principal", "hello/SayHello", meta.PriorityCritical, "ops", meta.PriorityCritical},
+		{"critical on configured route", "hello/Health", meta.PriorityCritical, "", meta.PriorityCritical},
+		{"critical from other principal", "hello/SayHello", meta.PriorityCritical, "alice", meta.PriorityNormal},
+		{"critical without principal", "hello/SayHello", meta.PriorityCritical, "", meta.PriorityNormal},
+		{"low is kept", "hello/SayHello", meta.PriorityLow, "alice", meta.PriorityLow},
+		{"unknown is normal", "hello/SayHello", "urgent", "ops", meta.PriorityNormal},
+	}
+	l := newConcurrencyLimiter("hello", 8, newTestConcurrencyConf(4))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != "" {
+				ctx = newPrincipalContext(ctx, &Principal{Name: tt.principal})
+			}
+			if got := l.priorityOf(ctx, tt.route, tt.priority); got != tt.want {
+				t.Fatalf("priority = %s, want %s", got, tt.want)
+			}
+		})
+	}
+	if got := newConcurrencyLimiter("hello", 8, nil).priorityOf(context.Background(), "hello/Health", meta.PriorityCritical); got != meta.PriorityNormal {
+		t.Fatalf("priority without conf = %s, want normal", got)
+	}
+}
+
+func TestConcurrencyLimiterAIMD(t *testing.T) {
+	l := newConcurrencyLimiter("hello", 8, newTestConcurrencyConf(4))
+	// 超时时按 BackoffRatio 减小
+	l.acquire(meta.PriorityNormal)
+	l.release(time.Millisecond, true)
+	if got := l.current.Load(); got != 2 {
+		t.Fatalf("limit after drop = %d, want 2", got)
+	}
+	// 并发用到一半以上且没有超过阈值时加 1
+	l.acquire(meta.PriorityNormal)
+	l.release(time.Millisecond, false)
+	if got := l.current.Load(); got != 3 {
+		t.Fatalf("limit after success = %d, want 3", got)
+	}
+	// 不低于 MinLimit
+	for i := 0; i < 10; i++ {
+		l.acquire(meta.PriorityNormal)
+		l.release(time.Second, false)
+	}
+	if got := l.current.Load(); got != 1 {
+		t.Fatalf("limit after slow requests = %d, want 1", got)
+	}
+}
+
+func TestConcurrencyLimiterStream(t *testing.T) {
+	l := newConcurrencyLimiter("hello", 2, newTestConcurrencyConf(2))
+	ctx := meta.NewRouteContext(context.Background(), "hello/Chat")
+	for i := 0; i < 2; i++ {
+		if !l.acquireContext(ctx) {
+			t.Fatalf("stream %d rejected", i)
+		}
+	}
+	if l.acquireContext(ctx) {
+		t.Fatal("stream over limit accepted")
+	}
+	l.releaseStream()
+	if got := l.current.Load(); got != 2 {
+		t.Fatalf("limit changed by stream release: %d", got)
+	}
+	if !l.acquireContext(ctx) {
+		t.Fatal("stream after release rejected")
+	}
+}
+
+func TestConcurrencyServerInterceptor(t *testing.T) {
+	l := newConcurrencyLimiter("hello", 1, newTestConcurrencyConf(1))
+	ctx := meta.NewRouteContext(context.Background(), "hello/SayHello")
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	go l.serverInterceptor(ctx, nil, nil, "SayHello", nil, func(context.Context, any, Encoder, string, []byte) ([]byte, error) {
+		close(entered)
+		<-release
+		return nil, nil
+	})
+	<-entered
+	_, err := l.serverInterceptor(ctx, nil, nil, "SayHello", nil, func(context.Context, any, Encoder, string, []byte) ([]byte, error) {
+		t.Fatal("dispatch over limit")
+		return nil, nil
+	})
+	if err != errors.ErrServerOverloaded {
+		t.Fatalf("err = %v, want server overloaded", err)
+	}
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for l.inflight.Load() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("slot not released after dispatch returned")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
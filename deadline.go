@@ -0,0 +1,42 @@
+package civet
+
+import (
+	"context"
+	errors2 "github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/meta"
+	"strconv"
+	"time"
+)
+
+// setTimeoutHeader 将 ctx 剩余的超时时间写入 header，服务端据此设置请求的超时；
+// ctx 没有超时时删除 header 中从上游继承的值，ctx 已超时返回 ErrRequestTimeout
+func setTimeoutHeader(ctx context.Context, header map[string]string) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		delete(header, meta.Timeout)
+		return nil
+	}
+	remain := time.Until(deadline)
+	if remain <= 0 {
+		return errors2.ErrRequestTimeout
+	}
+	// 不足 1ms 的部分向上取整，避免服务端收到 0
+	ms := (remain + time.Millisecond - 1) / time.Millisecond
+	header[meta.Timeout] = strconv.FormatInt(int64(ms), 10)
+	return nil
+}
+
+// withRequestTimeout 服务端请求的超时取客户端剩余时间与 reqTimeout 中较小的一个，
+// 处理请求时发起的调用使用该 ctx，继承剩余的超时时间
+func withRequestTimeout(parent context.Context, header map[string]string, reqTimeout time.Duration) (context.Context, context.CancelFunc) {
+	timeout := reqTimeout
+	if ms, err := strconv.ParseInt(header[meta.Timeout], 10, 64); err == nil && ms > 0 {
+		if d := time.Duration(ms) * time.Millisecond; timeout <= 0 || d < timeout {
+			timeout = d
+		}
+	}
+	if timeout > 0 {
+		return context.WithTimeout(parent, timeout)
+	}
+	return context.WithCancel(parent)
+}
@@ -0,0 +1,82 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrUnknownMethod Dispatch 找不到 method 时返回的错误，可以用 fmt.Errorf("%w ...") 包装；
+// metrics 中返回该错误的请求 method 记为 unknown，避免客户端随意构造的 method 产生大量时间序列
+var ErrUnknownMethod = errors.New("unknown method")
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type reflectMethod struct {
+	fn      reflect.Value
+	reqType reflect.Type
+}
+
+// ReflectDispatch 通过反射生成 Dispatch，impl 中第一个参数为 context.Context 的导出方法均视为 rpc 方法，
+// 签名必须为 func(ctx context.Context, req *Req) (*Resp, error)，否则 panic。
+// 调用时使用 Dispatch 传入的 impl，其类型必须与生成时的 impl 相同
+func ReflectDispatch(impl any) Dispatch {
+	methods, err := reflectMethods(impl)
+	if err != nil {
+		panic(err)
+	}
+	implType := reflect.TypeOf(impl)
+	return func(ctx context.Context, impl any, enc Encoder, method string, in []byte) ([]byte, error) {
+		recv := reflect.ValueOf(impl)
+		if !recv.IsValid() || recv.Type() != implType {
+			return nil, fmt.Errorf("reflect dispatch: impl must be %s, got %T", implType, impl)
+		}
+		m, ok := methods[method]
+		if !ok {
+			return nil, fmt.Errorf("%w %s", ErrUnknownMethod, method)
+		}
+		req := reflect.New(m.reqType)
+		if err := enc.Unmarshal(in, req.Interface()); err != nil {
+			return nil, err
+		}
+		out := m.fn.Call([]reflect.Value{recv, reflect.ValueOf(ctx), req})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return nil, err
+		}
+		return enc.Marshal(out[0].Interface())
+	}
+}
+
+func reflectMethods(impl any) (map[string]*reflectMethod, error) {
+	if impl == nil {
+		return nil, fmt.Errorf("reflect dispatch: impl is nil")
+	}
+	t := reflect.TypeOf(impl)
+	methods := make(map[string]*reflectMethod)
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		mt := m.Type
+		// 接收者为第 0 个参数
+		if mt.NumIn() < 2 || mt.In(1) != contextType {
+			continue
+		}
+		if mt.NumIn() != 3 || mt.NumOut() != 2 ||
+			mt.In(2).Kind() != reflect.Pointer ||
+			mt.Out(0).Kind() != reflect.Pointer ||
+			mt.Out(1) != errorType {
+			return nil, fmt.Errorf("reflect dispatch: %s.%s must be func(context.Context, *Req) (*Resp, error), got %s", t, m.Name, mt)
+		}
+		methods[m.Name] = &reflectMethod{
+			fn:      m.Func,
+			reqType: mt.In(2).Elem(),
+		}
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("reflect dispatch: %s has no rpc method", t)
+	}
+	return methods, nil
+}
@@ -2,6 +2,7 @@ package civet
 
 import (
 	"github.com/YCloud/civet/encoder/jsonencoder"
+	"github.com/YCloud/civet/encoder/protoencoder"
 )
 
 type Encoder interface {
@@ -14,6 +15,7 @@ var encoderMap = map[string]Encoder{}
 
 func init() {
 	RegisterEncoder(jsonencoder.NewJSONEncoder())
+	RegisterEncoder(protoencoder.NewProtoEncoder())
 }
 
 func RegisterEncoder(enc Encoder) {
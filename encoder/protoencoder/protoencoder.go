@@ -0,0 +1,32 @@
+package protoencoder
+
+import (
+	"fmt"
+	"google.golang.org/protobuf/proto"
+)
+
+type protoEncoder struct{}
+
+func NewProtoEncoder() *protoEncoder {
+	return &protoEncoder{}
+}
+
+func (*protoEncoder) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protoencoder: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (*protoEncoder) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protoencoder: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+func (*protoEncoder) Name() string {
+	return "proto"
+}
@@ -1,13 +1,15 @@
 package civet
 
-import "fmt"
+import "net"
 
 type Endpoint struct {
-	IP     string
-	Port   string
-	Weight int32
+	IP       string            `yaml:"ip" json:"ip"`
+	Port     string            `yaml:"port" json:"port"`
+	Weight   int32             `yaml:"weight" json:"weight"`
+	Metadata map[string]string `yaml:"metadata,omitempty" json:"metadata,omitempty"`
 }
 
+// IPPort 节点的地址，IPv6 地址带方括号，例如 [::1]:80
 func (e *Endpoint) IPPort() string {
-	return fmt.Sprintf("%s:%s", e.IP, e.Port)
+	return net.JoinHostPort(e.IP, e.Port)
 }
@@ -4,6 +4,14 @@ import "encoding/json"
 
 var (
 	ErrRequestTimeout = NewError("", 502, "request timeout")
+	// 没有凭证或凭证无效
+	ErrUnauthenticated = NewError("", 401, "unauthenticated")
+	// 调用方没有该路由的权限
+	ErrPermissionDenied = NewError("", 403, "permission denied")
+	// 超过限流规则，客户端应退避后再重试
+	ErrRateLimited = NewError("", 429, "rate limited")
+	// 超过服务端的并发限制，请求没有被处理
+	ErrServerOverloaded = NewError("", 503, "server overloaded")
 )
 
 type Error struct {
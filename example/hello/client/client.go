@@ -9,10 +9,10 @@ import (
 )
 
 func main() {
-	client := civet.NewClient("hello", civet.WithClientOptionEndpoint(&civet.Endpoint{
+	client := model.NewHelloServiceClient(civet.NewClient("hello", civet.WithClientOptionEndpoint(&civet.Endpoint{
 		IP:   "127.0.0.1",
 		Port: "10010",
-	}))
+	})))
 	wg := sync.WaitGroup{}
 	n := 10
 	wg.Add(n)
@@ -20,8 +20,7 @@ func main() {
 		go func(i int) {
 			defer wg.Done()
 			req := &model.HelloReq{Name: fmt.Sprintf("civet %d", i)}
-			resp := &model.HelloResp{}
-			err := client.Call(context.TODO(), "SayHello", "", req, resp)
+			resp, err := client.SayHello(context.TODO(), req)
 			if err != nil {
 				fmt.Println(err)
 				return
@@ -0,0 +1,9 @@
+package model
+
+import "context"
+
+//go:generate go run github.com/YCloud/civet/cmd/civet-gen -type HelloService
+
+type HelloService interface {
+	SayHello(ctx context.Context, req *HelloReq) (*HelloResp, error)
+}
@@ -0,0 +1,48 @@
+// Code generated by civet-gen. DO NOT EDIT.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"github.com/YCloud/civet"
+)
+
+// HelloServiceDispatch 作为 civet.AddRPCServant 的 dispatch 参数，impl 需实现 HelloService
+func HelloServiceDispatch(ctx context.Context, impl any, enc civet.Encoder, method string, in []byte) ([]byte, error) {
+	obj, ok := impl.(HelloService)
+	if !ok {
+		return nil, fmt.Errorf("impl %T does not implement HelloService", impl)
+	}
+	switch method {
+	case "SayHello":
+		req := &HelloReq{}
+		if err := enc.Unmarshal(in, req); err != nil {
+			return nil, err
+		}
+		resp, err := obj.SayHello(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return enc.Marshal(resp)
+	default:
+		return nil, fmt.Errorf("%w %s", civet.ErrUnknownMethod, method)
+	}
+}
+
+// HelloServiceClient HelloService 的强类型客户端
+type HelloServiceClient struct {
+	client *civet.Client
+}
+
+func NewHelloServiceClient(client *civet.Client) *HelloServiceClient {
+	return &HelloServiceClient{client: client}
+}
+
+func (c *HelloServiceClient) SayHello(ctx context.Context, req *HelloReq, options ...civet.ClientCallOption) (*HelloResp, error) {
+	resp := &HelloResp{}
+	if err := c.client.Call(ctx, "SayHello", "", req, resp, options...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
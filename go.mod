@@ -2,4 +2,7 @@ module github.com/YCloud/civet
 
 go 1.20
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	google.golang.org/protobuf v1.31.0
+	gopkg.in/yaml.v3 v3.0.1
+)
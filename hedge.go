@@ -0,0 +1,199 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	"github.com/YCloud/civet/internal/config"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HedgePolicy 对冲请求策略：第一次请求在 Delay 内没有返回时向其他节点再发一次，取最先返回的结果并取消其余请求。
+// 会增加服务端的负载，只对幂等的方法生效，见 WithClientIdempotentMethods
+type HedgePolicy struct {
+	// 最大请求数，包含第一次请求
+	MaxAttempts int
+	Delay       time.Duration
+	// 使用该方法最近请求耗时的 p95 作为延迟，样本不足时使用 Delay
+	UseP95 bool
+}
+
+func newHedgePolicy(cfg *config.HedgeConf) *HedgePolicy {
+	return &HedgePolicy{
+		MaxAttempts: cfg.MaxAttempts,
+		Delay:       cfg.Delay,
+		UseP95:      cfg.UseP95,
+	}
+}
+
+// WithClientHedgePolicy 设置方法的对冲策略，覆盖配置中的 hedge
+func WithClientHedgePolicy(method string, policy *HedgePolicy) ClientOption {
+	return func(client *Client) {
+		client.hedgePolicies[method] = policy
+	}
+}
+
+// WithClientCallOptionHedge 本次调用使用的对冲策略，设置后不再重试；只对幂等的方法或调用生效
+func WithClientCallOptionHedge(policy *HedgePolicy) ClientCallOption {
+	return func(o *clientCallOptions) {
+		o.hedgePolicy = policy
+	}
+}
+
+// getHedgePolicy 只对幂等的方法对冲，指定了节点或 rsp 不是指针时不做对冲
+func (client *Client) getHedgePolicy(method string, ipport string, rsp any, callOptions *clientCallOptions) *HedgePolicy {
+	if len(ipport) != 0 {
+		return nil
+	}
+	if !callOptions.idempotent && !client.idempotent[method] {
+		return nil
+	}
+	policy := callOptions.hedgePolicy
+	if policy == nil {
+		policy = client.hedgePolicies[method]
+	}
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return nil
+	}
+	if t := reflect.TypeOf(rsp); t == nil || t.Kind() != reflect.Pointer {
+		return nil
+	}
+	return policy
+}
+
+type hedgeResult struct {
+	body    []byte
+	err     error
+	latency time.Duration
+}
+
+// hedgeEncoder 解码时记录响应的 body，最先成功的请求的 body 再解码到调用方的 rsp
+type hedgeEncoder struct {
+	Encoder
+	body []byte
+}
+
+func (e *hedgeEncoder) Unmarshal(data []byte, addr any) error {
+	e.body = data
+	return e.Encoder.Unmarshal(data, addr)
+}
+
+// hedgeCall 每次请求都经过拦截器并解码到独立的 rsp，最先成功的响应重新解码到调用方的 rsp；
+// 额外的请求与重试共用 retryBudget，Call 中已经存入令牌
+func (client *Client) hedgeCall(ctx context.Context, method string, reqHeader map[string]string, body []byte,
+	enc Encoder, rsp any, policy *HedgePolicy) error {
+	ctx = withTriedEndpoints(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	// 返回时取消落后的请求，invoker 随之删除 reqData 中的记录
+	defer cancel()
+
+	rspType := reflect.TypeOf(rsp).Elem()
+	results := make(chan *hedgeResult, policy.MaxAttempts)
+	started, finished := 0, 0
+	start := func() {
+		started++
+		reqMsg := client.newRequest(method, reqHeader, body)
+		attemptRsp := reflect.New(rspType).Interface()
+		attemptEnc := &hedgeEncoder{Encoder: enc}
+		go func() {
+			begin := time.Now()
+			err := client.invoke(ctx, "", reqMsg, attemptEnc, attemptRsp)
+			results <- &hedgeResult{body: attemptEnc.body, err: err, latency: time.Since(begin)}
+		}()
+	}
+
+	delay := client.hedgeDelay(method, policy)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	start()
+	for {
+		select {
+		case <-timer.C:
+			if started < policy.MaxAttempts && client.retryBudget.withdraw() {
+				start()
+				timer.Reset(delay)
+			}
+		case res := <-results:
+			finished++
+			if res.err == nil {
+				client.recordLatency(method, res.latency)
+				return enc.Unmarshal(res.body, rsp)
+			}
+			if !hedgeable(res.err) || ctx.Err() != nil {
+				return res.err
+			}
+			// 失败的请求不再等待延迟，立即向其他节点发起
+			if started < policy.MaxAttempts && client.retryBudget.withdraw() {
+				start()
+				continue
+			}
+			if finished == started {
+				return res.err
+			}
+		}
+	}
+}
+
+// hedgeable 连接错误与 5xx 错误时继续等待其他请求，业务错误直接返回
+func hedgeable(err error) bool {
+	return isBreakerFailure(err) || errors.Is(err, ErrNoEndpoint) || errors.Is(err, ErrBreakerOpen)
+}
+
+func (client *Client) hedgeDelay(method string, policy *HedgePolicy) time.Duration {
+	if policy.UseP95 {
+		if v, ok := client.latencies.Load(method); ok {
+			if p95 := v.(*latencyWindow).p95(); p95 > 0 {
+				return p95
+			}
+		}
+	}
+	return policy.Delay
+}
+
+func (client *Client) recordLatency(method string, latency time.Duration) {
+	v, ok := client.latencies.Load(method)
+	if !ok {
+		v, _ = client.latencies.LoadOrStore(method, &latencyWindow{})
+	}
+	v.(*latencyWindow).add(latency)
+}
+
+const (
+	latencyWindowSize = 128
+	latencyMinSamples = 20
+)
+
+// latencyWindow 保存最近 latencyWindowSize 次成功请求的耗时
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples [latencyWindowSize]time.Duration
+	n       int
+}
+
+func (w *latencyWindow) add(latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.samples[w.n%latencyWindowSize] = latency
+	w.n++
+}
+
+// p95 样本少于 latencyMinSamples 时返回 0
+func (w *latencyWindow) p95() time.Duration {
+	w.mu.Lock()
+	n := w.n
+	if n > latencyWindowSize {
+		n = latencyWindowSize
+	}
+	samples := make([]time.Duration, n)
+	copy(samples, w.samples[:n])
+	w.mu.Unlock()
+	if n < latencyMinSamples {
+		return 0
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i] < samples[j]
+	})
+	return samples[n*95/100]
+}
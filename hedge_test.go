@@ -0,0 +1,71 @@
+package civet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YCloud/civet/encoder/jsonencoder"
+)
+
+func TestGetHedgePolicy(t *testing.T) {
+	policy := &HedgePolicy{MaxAttempts: 2, Delay: 10 * time.Millisecond}
+	newClient := func() *Client {
+		return &Client{
+			idempotent:    map[string]bool{"Get": true},
+			hedgePolicies: map[string]*HedgePolicy{"Get": policy, "Set": policy},
+		}
+	}
+	var rsp struct{}
+
+	tests := []struct {
+		name    string
+		method  string
+		ipport  string
+		rsp     any
+		options []ClientCallOption
+		want    *HedgePolicy
+	}{
+		{"idempotent method", "Get", "", &rsp, nil, policy},
+		{"not idempotent method", "Set", "", &rsp, nil, nil},
+		{"idempotent call", "Set", "", &rsp, []ClientCallOption{WithClientCallOptionIdempotent()}, policy},
+		{"call policy on not idempotent method", "Other", "", &rsp, []ClientCallOption{WithClientCallOptionHedge(policy)}, nil},
+		{"call policy on idempotent call", "Other", "", &rsp,
+			[]ClientCallOption{WithClientCallOptionHedge(policy), WithClientCallOptionIdempotent()}, policy},
+		{"single attempt", "Get", "", &rsp, []ClientCallOption{WithClientCallOptionHedge(&HedgePolicy{MaxAttempts: 1})}, nil},
+		{"endpoint specified", "Get", "127.0.0.1:10099", &rsp, nil, nil},
+		{"rsp not pointer", "Get", "", rsp, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callOptions := &clientCallOptions{}
+			for _, option := range tt.options {
+				option(callOptions)
+			}
+			if got := newClient().getHedgePolicy(tt.method, tt.ipport, tt.rsp, callOptions); got != tt.want {
+				t.Fatalf("policy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHedgeEncoder(t *testing.T) {
+	type resp struct {
+		Message string
+	}
+	enc := &hedgeEncoder{Encoder: jsonencoder.NewJSONEncoder()}
+	attempt := &resp{}
+	if err := enc.Unmarshal([]byte(`{"Message":"hi"}`), attempt); err != nil {
+		t.Fatal(err)
+	}
+	if attempt.Message != "hi" {
+		t.Fatalf("attempt = %+v", attempt)
+	}
+	// 调用方的 rsp 由记录的 body 重新解码，不复制 attempt
+	caller := &resp{}
+	if err := enc.Encoder.Unmarshal(enc.body, caller); err != nil {
+		t.Fatal(err)
+	}
+	if caller.Message != "hi" {
+		t.Fatalf("caller = %+v", caller)
+	}
+}
@@ -2,15 +2,17 @@ package civet
 
 import (
 	"context"
+	"github.com/YCloud/civet/meta"
+	"github.com/YCloud/civet/trace"
 )
 
 type ClientInvoker func(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any) error
 
 type ClientInterceptor func(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any, invoker ClientInvoker) error
 
-func buildClientInterceptor(clientInterceptors ...ClientInterceptor) ClientInterceptor {
+func buildClientInterceptor(service string, clientInterceptors ...ClientInterceptor) ClientInterceptor {
 	interceptors := make([]ClientInterceptor, 0)
-	interceptors = append(interceptors, traceClientInterceptor)
+	interceptors = append(interceptors, traceClientInterceptor, newMetricsClientInterceptor(service))
 	interceptors = append(interceptors, clientInterceptors...)
 	interceptors = append(interceptors, recoverClientInterceptor)
 	return chainClientInterceptor(interceptors...)
@@ -41,10 +43,31 @@ func getChainClientInterceptor(interceptors []ClientInterceptor, curr int, final
 	}
 }
 
-func traceClientInterceptor(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any, invoker ClientInvoker) error {
+// traceClientInterceptor 每次请求（包括重试与对冲）创建一个 client span，并通过 header 传给服务端
+func traceClientInterceptor(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any, invoker ClientInvoker) (err error) {
+	ctx, span := startClientSpan(ctx, ipport, reqMsg)
+	defer func() {
+		span.End(err)
+	}()
 	return invoker(ctx, ipport, reqMsg, enc, rsp)
 }
 
+// startClientSpan 请求与流共用，把 span 写入请求 header 传给服务端
+func startClientSpan(ctx context.Context, ipport string, reqMsg *Request) (context.Context, *trace.Span) {
+	ctx, span := trace.Start(ctx, reqMsg.Route, trace.SpanKind_Client)
+	if len(ipport) != 0 {
+		span.SetAttribute("peer.address", ipport)
+	}
+	sc := span.SpanContext()
+	reqMsg.Header[meta.Traceparent] = sc.Traceparent()
+	if sc.TraceState != "" {
+		reqMsg.Header[meta.Tracestate] = sc.TraceState
+	} else {
+		delete(reqMsg.Header, meta.Tracestate)
+	}
+	return ctx, span
+}
+
 func recoverClientInterceptor(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any, invoker ClientInvoker) error {
 	defer func() {
 		if err := recover(); err != nil {
@@ -1,14 +1,18 @@
 package civet
 
 import (
+	"fmt"
+	"github.com/YCloud/civet/meta"
+	"github.com/YCloud/civet/trace"
 	"net/http"
+	"strconv"
 )
 
 type HttpInterceptor func(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc)
 
-func buildHttpInterceptor(httpInterceptors ...HttpInterceptor) HttpInterceptor {
+func buildHttpInterceptor(servant string, handler http.Handler, httpInterceptors ...HttpInterceptor) HttpInterceptor {
 	interceptors := make([]HttpInterceptor, 0)
-	interceptors = append(interceptors, traceHttpInterceptor)
+	interceptors = append(interceptors, traceHttpInterceptor, newMetricsHttpInterceptor(servant, handler))
 	interceptors = append(interceptors, httpInterceptors...)
 	interceptors = append(interceptors, recoverHttpInterceptor)
 	return chainHttpInterceptor(interceptors...)
@@ -39,11 +43,81 @@ func getChainHttpHandler(interceptors []HttpInterceptor, curr int, finalHandler
 	}
 }
 
+// responseWriter 记录响应的状态码，多个拦截器共用同一个
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func wrapResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap 供 http.ResponseController 使用
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Size 已写入的响应 body 字节数
+func (w *responseWriter) Size() int64 {
+	return w.size
+}
+
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// traceHttpInterceptor 以 traceparent header 为父节点创建 server span，状态码 5xx 记录为失败
 func traceHttpInterceptor(w http.ResponseWriter, req *http.Request, handler http.HandlerFunc) {
 	ctx := req.Context()
-	// TODO
+	if sc, ok := trace.ParseTraceparent(req.Header.Get(meta.Traceparent), req.Header.Get(meta.Tracestate)); ok {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+	}
+	ctx, span := trace.Start(ctx, req.Method+" "+req.URL.Path, trace.SpanKind_Server)
+	setAccessTraceID(ctx, span)
+	rw := wrapResponseWriter(w)
+	defer func() {
+		status := rw.Status()
+		span.SetAttribute("http.status_code", strconv.Itoa(status))
+		var err error
+		if status >= http.StatusInternalServerError {
+			err = fmt.Errorf("http status %d", status)
+		}
+		span.End(err)
+	}()
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.target", req.URL.RequestURI())
 	req = req.WithContext(ctx)
-	handler(w, req)
+	handler(rw, req)
 }
 
 func recoverHttpInterceptor(w http.ResponseWriter, req *http.Request, handler http.HandlerFunc) {
@@ -2,13 +2,15 @@ package civet
 
 import (
 	"context"
+	"github.com/YCloud/civet/meta"
+	"github.com/YCloud/civet/trace"
 )
 
 type ServerInterceptor func(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) ([]byte, error)
 
-func buildServerInterceptor(httpInterceptors ...ServerInterceptor) ServerInterceptor {
+func buildServerInterceptor(servant string, httpInterceptors ...ServerInterceptor) ServerInterceptor {
 	interceptors := make([]ServerInterceptor, 0)
-	interceptors = append(interceptors, traceServerInterceptor)
+	interceptors = append(interceptors, traceServerInterceptor, newMetricsServerInterceptor(servant))
 	interceptors = append(interceptors, httpInterceptors...)
 	interceptors = append(interceptors, recoverServerInterceptor)
 	return chainServerInterceptor(interceptors...)
@@ -39,10 +41,26 @@ func getChainServerHandler(interceptors []ServerInterceptor, curr int, finalDisp
 	}
 }
 
-func traceServerInterceptor(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) ([]byte, error) {
+// traceServerInterceptor 以请求 header 中的 traceparent 为父节点创建 server span，处理请求时发起的调用继承该 span
+func traceServerInterceptor(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) (out []byte, err error) {
+	ctx, span := startServerSpan(ctx, method)
+	setAccessTraceID(ctx, span)
+	defer func() {
+		span.End(err)
+	}()
 	return dispatch(ctx, impl, enc, method, in)
 }
 
+// startServerSpan 请求与流共用，流不经过拦截器，span 覆盖流的整个生命周期
+func startServerSpan(ctx context.Context, method string) (context.Context, *trace.Span) {
+	if header, ok := meta.FromMetaContextReqContext(ctx); ok {
+		if sc, ok := trace.ParseTraceparent(header[meta.Traceparent], header[meta.Tracestate]); ok {
+			ctx = trace.ContextWithRemoteSpanContext(ctx, sc)
+		}
+	}
+	return trace.Start(ctx, method, trace.SpanKind_Server)
+}
+
 func recoverServerInterceptor(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) ([]byte, error) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -1,10 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"gopkg.in/yaml.v3"
+	"io"
 	"os"
+	"reflect"
 	"runtime"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -18,69 +24,392 @@ type Config struct {
 	LogConf     *LogConf       `yaml:"logger"`
 	ServantList []*ServantConf `yaml:"servantList"`
 	ClientConf  *ClientConf    `yaml:"client"`
+	Registry    *RegistryConf  `yaml:"registry"`
+	Trace       *TraceConf     `yaml:"trace"`
+	Admin       *AdminConf     `yaml:"admin"`
 }
 
 type ServantConf struct {
-	Name          string        `yaml:"name"`
-	IP            string        `yaml:"ip"`
-	Port          string        `yaml:"port"`
-	ReadBufSize   int32         `yaml:"readBufSize"`
-	WriteBufSize  int32         `yaml:"writeBufSize"`
-	MaxRequestNum int32         `yaml:"maxRequestNum"`
-	ReqTimeout    time.Duration `yaml:"reqTimeout"`
+	Name            string            `yaml:"name"`
+	IP              string            `yaml:"ip"`
+	Port            string            `yaml:"port"`
+	ReadBufSize     int32             `yaml:"readBufSize"`
+	WriteBufSize    int32             `yaml:"writeBufSize"`
+	MaxRequestNum   int32             `yaml:"maxRequestNum"`
+	ReqTimeout      time.Duration     `yaml:"reqTimeout"`
+	StreamWindow    int32             `yaml:"streamWindow"`
+	IdleTimeout     time.Duration     `yaml:"idleTimeout"`
+	Weight          int32             `yaml:"weight"`
+	Metadata        map[string]string `yaml:"metadata"`
+	ShutdownTimeout time.Duration     `yaml:"shutdownTimeout"`
+	// 单个连接同时处理的请求数，达到上限后暂停读取该连接，默认与 MaxRequestNum 相同
+	MaxConnRequestNum int32 `yaml:"maxConnRequestNum"`
+	// 访问日志，为空时不记录
+	AccessLog *AccessLogConf `yaml:"accessLog"`
+	// 为空时不开启 TLS，rpc 与 http servant 都可以使用
+	TLS *TLSConf `yaml:"tls"`
+	// 为空时不认证
+	Auth *AuthConf `yaml:"auth"`
+	// 为空时不限流，可以通过 reload 或管理接口在运行时修改
+	RateLimit *RateLimitConf `yaml:"rateLimit"`
+	// 自适应并发限制，为空时并发上限固定为 MaxRequestNum
+	Concurrency *ConcurrencyConf `yaml:"concurrency"`
+}
+
+// ConcurrencyConf 根据请求耗时调整并发上限，上限不超过 MaxRequestNum；流在关闭前占用一个并发，不参与调整上限
+type ConcurrencyConf struct {
+	// gradient 或 aimd，默认 gradient
+	Algorithm    string `yaml:"algorithm"`
+	InitialLimit int    `yaml:"initialLimit"`
+	MinLimit     int    `yaml:"minLimit"`
+	// gradient：短期耗时超过长期耗时的 Tolerance 倍后开始减小并发，默认 2
+	Tolerance float64 `yaml:"tolerance"`
+	// aimd：耗时超过该值或超时时按 BackoffRatio 减小并发，否则加 1，默认 100ms 与 0.9
+	LatencyThreshold time.Duration `yaml:"latencyThreshold"`
+	BackoffRatio     float64       `yaml:"backoffRatio"`
+	// low 优先级的请求只能使用该比例的并发，默认 0.8
+	LowPriorityRatio float64 `yaml:"lowPriorityRatio"`
+	// Priority 由客户端设置，只有认证后的调用方在 CriticalPrincipals 中，
+	// 或路由匹配 CriticalRoutes 时 critical 请求才可以使用全部并发，否则按 normal 处理。
+	// 路由支持 servant/* 与 /path/*
+	CriticalPrincipals []string `yaml:"criticalPrincipals"`
+	CriticalRoutes     []string `yaml:"criticalRoutes"`
+}
+
+// RateLimitConf 请求需要通过所有匹配的规则，超过限制时返回 429
+type RateLimitConf struct {
+	Rules []*RateLimitRule `yaml:"rules"`
+}
+
+type RateLimitRule struct {
+	// token_bucket 或 sliding_window，默认 token_bucket
+	Type string `yaml:"type"`
+	// 为空时对所有路由生效，支持 servant/* 与 /path/*
+	Route string `yaml:"route"`
+	// 不为空时按该 header 的值分别限流，如 Caller 表示每个调用方单独限流。
+	// header 由客户端设置，可以伪造，调用方可以更换取值绕过限流；
+	// 开启认证时应使用 principal，按认证后的调用方限流，未认证的请求共用一个限流器
+	Key string `yaml:"key"`
+	// Window 内允许的请求数
+	Limit int `yaml:"limit"`
+	// 默认 1s
+	Window time.Duration `yaml:"window"`
+	// token_bucket 的容量，默认为 Limit
+	Burst int `yaml:"burst"`
+}
+
+// AuthConf servant 的认证与授权，依次尝试 tls、bearer、hmac、jwt，使用第一个携带了凭证的方式
+type AuthConf struct {
+	// 使用客户端证书的 CommonName 作为调用方，需开启 mTLS
+	TLS bool `yaml:"tls"`
+	// token 到调用方的映射
+	BearerTokens map[string]string `yaml:"bearerTokens"`
+	// keyId 到密钥的映射，keyId 作为调用方
+	HMACKeys map[string]string `yaml:"hmacKeys"`
+	// 时间戳允许的偏差，也是防重放的窗口，默认 5m
+	HMACWindow time.Duration `yaml:"hmacWindow"`
+	JWT        *JWTConf      `yaml:"jwt"`
+	// 路由到允许的调用方，rpc 的路由为 servant/method，http 为 path。
+	// 路由支持 servant/*、/path/* 与 *，调用方 * 表示任意已认证的调用方；未匹配的路由只需要通过认证
+	ACL map[string][]string `yaml:"acl"`
+}
+
+type JWTConf struct {
+	// 本地 JWKS 文件，修改后自动重新加载
+	JWKSFile string `yaml:"jwksFile"`
+	// 不为空时校验 iss 与 aud
+	Issuer   string `yaml:"issuer"`
+	Audience string `yaml:"audience"`
+	// 校验 exp、nbf 时允许的时钟偏差
+	Leeway time.Duration `yaml:"leeway"`
+}
+
+// CredentialsConf 客户端请求携带的凭证，Token 与 HMAC 二选一
+type CredentialsConf struct {
+	// 静态 token 或 JWT
+	Token      string `yaml:"token"`
+	HMACKeyId  string `yaml:"hmacKeyId"`
+	HMACSecret string `yaml:"hmacSecret"`
+}
+
+// TLSConf 证书文件修改后会自动重新加载，新连接使用新证书
+type TLSConf struct {
+	// 服务端必须配置；客户端配置后在服务端要求时提供证书
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+	// 校验对端证书的 CA，客户端为空时使用系统 CA
+	CAFile string `yaml:"caFile"`
+	// 1.0、1.1、1.2 或 1.3，默认 1.2
+	MinVersion string `yaml:"minVersion"`
+	// 服务端校验客户端证书的方式：none、request、require、verify、require_and_verify，默认 none
+	ClientAuth string `yaml:"clientAuth"`
+	// 客户端校验服务端证书使用的域名，为空时使用节点 IP
+	ServerName         string `yaml:"serverName"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+	// 检查证书文件是否修改的间隔，默认 10s
+	ReloadInterval time.Duration `yaml:"reloadInterval"`
+}
+
+// AccessLogConf 每个请求一行的访问日志，写入单独的文件
+type AccessLogConf struct {
+	LogPath string `yaml:"logPath"`
+	// 默认为 {servant}_access.log
+	LogName string `yaml:"logName"`
+	// text 或 json
+	Encoder    string        `yaml:"encoder"`
+	MaxSize    int           `yaml:"maxSize"`
+	MaxBackups int           `yaml:"maxBackups"`
+	MaxAge     time.Duration `yaml:"maxAge"`
+	Rotate     string        `yaml:"rotate"`
+	QueueSize  int           `yaml:"queueSize"`
+	// 采样比例，取值 0~1，默认全部记录
+	SampleRate float64 `yaml:"sampleRate"`
+	// 耗时达到该值的请求不受采样限制，总是记录
+	SlowThreshold time.Duration `yaml:"slowThreshold"`
 }
 
 type ClientConf struct {
-	MaxConnNum  int    `yaml:"maxConnNum"`
-	EncoderName string `yaml:"encoderName"`
+	MaxConnNum   int           `yaml:"maxConnNum"`
+	EncoderName  string        `yaml:"encoderName"` // json 或 proto
+	StreamWindow int32         `yaml:"streamWindow"`
+	PingInterval time.Duration `yaml:"pingInterval"`
+	PingMaxMiss  int32         `yaml:"pingMaxMiss"`
+	Balancer     string        `yaml:"balancer"`
+	HashKey      string        `yaml:"hashKey"`
+	Retry        *RetryConf    `yaml:"retry"`
+	Breaker      *BreakerConf  `yaml:"breaker"`
+	// 按方法名配置的对冲请求，只对 retry.idempotentMethods 中的幂等方法生效
+	Hedge map[string]*HedgeConf `yaml:"hedge"`
+	// 为空时使用明文连接
+	TLS         *TLSConf         `yaml:"tls"`
+	Credentials *CredentialsConf `yaml:"credentials"`
+}
+
+type HedgeConf struct {
+	MaxAttempts int           `yaml:"maxAttempts"`
+	Delay       time.Duration `yaml:"delay"`
+	// 使用该方法最近请求耗时的 p95 作为对冲延迟，样本不足时使用 Delay
+	UseP95 bool `yaml:"useP95"`
 }
 
+type BreakerConf struct {
+	Window         time.Duration `yaml:"window"`
+	MinRequests    int32         `yaml:"minRequests"`
+	ErrorRate      float64       `yaml:"errorRate"`
+	SlowThreshold  time.Duration `yaml:"slowThreshold"`
+	SlowRate       float64       `yaml:"slowRate"`
+	OpenTimeout    time.Duration `yaml:"openTimeout"`
+	HalfOpenProbes int32         `yaml:"halfOpenProbes"`
+}
+
+type RetryConf struct {
+	MaxAttempts       int           `yaml:"maxAttempts"`
+	InitialBackoff    time.Duration `yaml:"initialBackoff"`
+	MaxBackoff        time.Duration `yaml:"maxBackoff"`
+	Multiplier        float64       `yaml:"multiplier"`
+	Jitter            float64       `yaml:"jitter"`
+	RetryableCodes    []int32       `yaml:"retryableCodes"`
+	BudgetPercent     float64       `yaml:"budgetPercent"`
+	IdempotentMethods []string      `yaml:"idempotentMethods"`
+}
+
+type RegistryConf struct {
+	// 目前只支持 file
+	Type string `yaml:"type"`
+	Path string `yaml:"path"`
+}
+
+// AdminConf 管理接口，配置后 Run 自动启动，不注册到 Registry
+type AdminConf struct {
+	// 默认只监听 127.0.0.1，监听其他地址时应配置 Auth 与 TLS
+	IP   string `yaml:"ip"`
+	Port string `yaml:"port"`
+	// 为空时不认证，ACL 的路由为管理接口的 path，如 /reload
+	Auth *AuthConf `yaml:"auth"`
+	TLS  *TLSConf  `yaml:"tls"`
+}
+
+// ServantConf 管理接口作为 http servant 运行时使用的配置
+func (cfg *AdminConf) ServantConf() *ServantConf {
+	ip := cfg.IP
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	servantConf := &ServantConf{
+		Name: AdminServantName,
+		IP:   ip,
+		Port: cfg.Port,
+		Auth: cfg.Auth,
+		TLS:  cfg.TLS,
+	}
+	checkServantConf(servantConf)
+	return servantConf
+}
+
+type TraceConf struct {
+	// stdout、file 或 otlp
+	Exporter string `yaml:"exporter"`
+	// file 的文件路径
+	Path string `yaml:"path"`
+	// otlp 的地址，如 http://127.0.0.1:4318/v1/traces
+	Endpoint string            `yaml:"endpoint"`
+	Headers  map[string]string `yaml:"headers"`
+}
+
+// LogConf LogName 为空时输出到标准输出
 type LogConf struct {
 	LogPath string `yaml:"logPath"`
 	LogName string `yaml:"logName"`
+	// debug、info、warn 或 error，为空时不修改
+	Level string `yaml:"level"`
+	// text 或 json
+	Encoder string `yaml:"encoder"`
+	// 单个文件的最大 MB，0 表示不按大小切分
+	MaxSize int `yaml:"maxSize"`
+	// 保留的历史文件个数
+	MaxBackups int           `yaml:"maxBackups"`
+	MaxAge     time.Duration `yaml:"maxAge"`
+	// hourly、daily，为空时只按大小切分
+	Rotate string `yaml:"rotate"`
+	// 异步写入的队列长度
+	QueueSize int `yaml:"queueSize"`
+	// 队列满时丢弃 newest 或 oldest
+	DropPolicy string `yaml:"dropPolicy"`
+	// 输出到 *c 日志中的请求 header
+	Headers []string `yaml:"headers"`
 }
 
+const defaultStreamWindow = 64
+
+// AdminServantName 管理接口的 servant 名，servantList 中不能使用
+const AdminServantName = "admin"
+
+// DefaultRetryBudgetPercent 重试请求最多占总请求的百分比
+const DefaultRetryBudgetPercent float64 = 20
+
 var (
 	configPath = flag.String("config", "config.yaml", "--config=config.yaml")
 	initOnce   sync.Once
+	mu         sync.RWMutex
 )
 
 func initConfig() {
 	flag.Parse()
-	file, err := os.Open(*configPath)
+	conf, err := load(*configPath)
 	if err != nil {
 		panic(err)
 	}
-	defer file.Close()
+	cfg = conf
+}
 
-	decoder := yaml.NewDecoder(file)
+func load(path string) (*Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
 
 	conf := &Config{}
-	err = decoder.Decode(conf)
-	if err != nil {
-		panic(err)
+	if err = unmarshal(file, conf); err != nil {
+		return nil, err
 	}
-	cfg = conf
 
-	for _, servant := range cfg.ServantList {
+	for _, servant := range conf.ServantList {
 		checkServantConf(servant)
 	}
-	if cfg.ClientConf == nil {
-		cfg.ClientConf = &ClientConf{}
+	if conf.LogConf != nil {
+		checkLogConf(conf.LogConf)
+	}
+	if conf.ClientConf == nil {
+		conf.ClientConf = &ClientConf{}
+	}
+	checkClientConf(conf.ClientConf)
+	return conf, nil
+}
+
+// Reload 重新读取配置文件，读取失败时保留原配置。
+// 已经创建的 servant 与 client 持有旧的配置，只有在使用时读取 GetConfig 的部分会生效
+func Reload() (*Config, error) {
+	GetConfig()
+	conf, err := load(*configPath)
+	if err != nil {
+		return nil, err
 	}
-	checkClientConf(cfg.ClientConf)
+	mu.Lock()
+	cfg = conf
+	mu.Unlock()
+	return conf, nil
 }
 
 func GetConfig() *Config {
 	initOnce.Do(initConfig)
+	mu.RLock()
+	defer mu.RUnlock()
 	if cfg == nil {
 		panic("config not init")
 	}
 	return cfg
 }
 
+// redactedValue 替换配置中的密钥
+const redactedValue = "******"
+
+// Redacted 返回去掉 token、密钥与 trace header 值的副本，用于对外展示配置
+func (c *Config) Redacted() (*Config, error) {
+	bs, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	conf := &Config{}
+	if err = yaml.Unmarshal(bs, conf); err != nil {
+		return nil, err
+	}
+	for _, servantConf := range conf.ServantList {
+		servantConf.Auth.redact()
+	}
+	if conf.Admin != nil {
+		conf.Admin.Auth.redact()
+	}
+	if conf.ClientConf != nil && conf.ClientConf.Credentials != nil {
+		creds := conf.ClientConf.Credentials
+		if creds.Token != "" {
+			creds.Token = redactedValue
+		}
+		if creds.HMACSecret != "" {
+			creds.HMACSecret = redactedValue
+		}
+	}
+	if conf.Trace != nil {
+		for k := range conf.Trace.Headers {
+			conf.Trace.Headers[k] = redactedValue
+		}
+	}
+	return conf, nil
+}
+
+// redact bearerTokens 的 key 为 token，替换为序号，只保留调用方
+func (a *AuthConf) redact() {
+	if a == nil {
+		return
+	}
+	if len(a.BearerTokens) > 0 {
+		callers := make([]string, 0, len(a.BearerTokens))
+		for _, caller := range a.BearerTokens {
+			callers = append(callers, caller)
+		}
+		sort.Strings(callers)
+		a.BearerTokens = make(map[string]string, len(callers))
+		for i, caller := range callers {
+			a.BearerTokens[fmt.Sprintf("%s%d", redactedValue, i+1)] = caller
+		}
+	}
+	for keyId := range a.HMACKeys {
+		a.HMACKeys[keyId] = redactedValue
+	}
+}
+
 func GetServantConf(name string) *ServantConf {
-	cfg = GetConfig()
+	cfg := GetConfig()
 	for _, servantConf := range cfg.ServantList {
 		if servantConf.Name == name {
 			return servantConf
@@ -90,15 +419,132 @@ func GetServantConf(name string) *ServantConf {
 }
 
 func GetClientConf() *ClientConf {
-	cfg = GetConfig()
-	return cfg.ClientConf
+	return GetConfig().ClientConf
+}
+
+func checkLogConf(cfg *LogConf) {
+	if cfg.Encoder == "" {
+		cfg.Encoder = "text"
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.DropPolicy == "" {
+		cfg.DropPolicy = "newest"
+	}
 }
 
 func checkServantConf(cfg *ServantConf) {
 	if cfg.MaxRequestNum <= 0 {
 		cfg.MaxRequestNum = 10000
 	}
-	cfg.ReqTimeout = parserTimeDuration(cfg.ReqTimeout, time.Millisecond, 0)
+	if cfg.MaxConnRequestNum <= 0 {
+		cfg.MaxConnRequestNum = cfg.MaxRequestNum
+	}
+	cfg.ReqTimeout = parserTimeDuration(cfg.ReqTimeout, 0)
+	if cfg.StreamWindow <= 0 {
+		cfg.StreamWindow = defaultStreamWindow
+	}
+	cfg.IdleTimeout = parserTimeDuration(cfg.IdleTimeout, 0)
+	cfg.ShutdownTimeout = parserTimeDuration(cfg.ShutdownTimeout, 5*time.Second)
+	if cfg.AccessLog != nil {
+		checkAccessLogConf(cfg.Name, cfg.AccessLog)
+	}
+	if cfg.TLS != nil {
+		checkTLSConf(cfg.TLS)
+	}
+	if cfg.Auth != nil {
+		checkAuthConf(cfg.Auth)
+	}
+	if cfg.RateLimit != nil {
+		checkRateLimitConf(cfg.RateLimit)
+	}
+	if cfg.Concurrency != nil {
+		checkConcurrencyConf(cfg.Concurrency, int(cfg.MaxRequestNum))
+	}
+}
+
+func checkConcurrencyConf(cfg *ConcurrencyConf, maxLimit int) {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = "gradient"
+	}
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MinLimit > maxLimit {
+		cfg.MinLimit = maxLimit
+	}
+	if cfg.InitialLimit <= 0 {
+		cfg.InitialLimit = 20
+	}
+	if cfg.InitialLimit < cfg.MinLimit {
+		cfg.InitialLimit = cfg.MinLimit
+	}
+	if cfg.InitialLimit > maxLimit {
+		cfg.InitialLimit = maxLimit
+	}
+	if cfg.Tolerance < 1 {
+		cfg.Tolerance = 2
+	}
+	cfg.LatencyThreshold = parserTimeDuration(cfg.LatencyThreshold, 100*time.Millisecond)
+	if cfg.BackoffRatio <= 0 || cfg.BackoffRatio >= 1 {
+		cfg.BackoffRatio = 0.9
+	}
+	if cfg.LowPriorityRatio <= 0 || cfg.LowPriorityRatio > 1 {
+		cfg.LowPriorityRatio = 0.8
+	}
+}
+
+func checkRateLimitConf(cfg *RateLimitConf) {
+	for _, rule := range cfg.Rules {
+		if rule.Type == "" {
+			rule.Type = "token_bucket"
+		}
+		rule.Window = parserTimeDuration(rule.Window, time.Second)
+		if rule.Burst <= 0 {
+			rule.Burst = rule.Limit
+		}
+	}
+}
+
+// ParseRateLimitConf 解析 yaml 格式的限流规则并设置默认值，供管理接口使用
+func ParseRateLimitConf(bs []byte) (*RateLimitConf, error) {
+	cfg := &RateLimitConf{}
+	if err := unmarshal(bytes.NewReader(bs), cfg); err != nil {
+		return nil, err
+	}
+	checkRateLimitConf(cfg)
+	return cfg, nil
+}
+
+func checkAuthConf(cfg *AuthConf) {
+	cfg.HMACWindow = parserTimeDuration(cfg.HMACWindow, 5*time.Minute)
+}
+
+func checkTLSConf(cfg *TLSConf) {
+	if cfg.MinVersion == "" {
+		cfg.MinVersion = "1.2"
+	}
+	if cfg.ClientAuth == "" {
+		cfg.ClientAuth = "none"
+	}
+	cfg.ReloadInterval = parserTimeDuration(cfg.ReloadInterval, 10*time.Second)
+}
+
+func checkAccessLogConf(servant string, cfg *AccessLogConf) {
+	if cfg.LogName == "" {
+		cfg.LogName = servant + "_access.log"
+	}
+	if cfg.Encoder == "" {
+		cfg.Encoder = "text"
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	if cfg.SampleRate <= 0 || cfg.SampleRate > 1 {
+		cfg.SampleRate = 1
+	}
+	cfg.SlowThreshold = parserTimeDuration(cfg.SlowThreshold, 0)
 }
 
 func checkClientConf(cfg *ClientConf) {
@@ -108,11 +554,139 @@ func checkClientConf(cfg *ClientConf) {
 	if cfg.EncoderName == "" {
 		cfg.EncoderName = "json"
 	}
+	if cfg.StreamWindow <= 0 {
+		cfg.StreamWindow = defaultStreamWindow
+	}
+	cfg.PingInterval = parserTimeDuration(cfg.PingInterval, 10*time.Second)
+	if cfg.PingMaxMiss <= 0 {
+		cfg.PingMaxMiss = 3
+	}
+	if cfg.Retry != nil {
+		checkRetryConf(cfg.Retry)
+	}
+	if cfg.Breaker != nil {
+		checkBreakerConf(cfg.Breaker)
+	}
+	for _, hedge := range cfg.Hedge {
+		checkHedgeConf(hedge)
+	}
+	if cfg.TLS != nil {
+		checkTLSConf(cfg.TLS)
+	}
+}
+
+func checkHedgeConf(cfg *HedgeConf) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 2
+	}
+	cfg.Delay = parserTimeDuration(cfg.Delay, 100*time.Millisecond)
+}
+
+func checkBreakerConf(cfg *BreakerConf) {
+	cfg.Window = parserTimeDuration(cfg.Window, 10*time.Second)
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 20
+	}
+	if cfg.ErrorRate <= 0 || cfg.ErrorRate > 1 {
+		cfg.ErrorRate = 0.5
+	}
+	cfg.SlowThreshold = parserTimeDuration(cfg.SlowThreshold, 0)
+	if cfg.SlowRate <= 0 || cfg.SlowRate > 1 {
+		cfg.SlowRate = 0.5
+	}
+	cfg.OpenTimeout = parserTimeDuration(cfg.OpenTimeout, 5*time.Second)
+	if cfg.HalfOpenProbes <= 0 {
+		cfg.HalfOpenProbes = 3
+	}
+}
+
+func checkRetryConf(cfg *RetryConf) {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	cfg.InitialBackoff = parserTimeDuration(cfg.InitialBackoff, 50*time.Millisecond)
+	cfg.MaxBackoff = parserTimeDuration(cfg.MaxBackoff, time.Second)
+	if cfg.Multiplier < 1 {
+		cfg.Multiplier = 2
+	}
+	if cfg.Jitter <= 0 || cfg.Jitter > 1 {
+		cfg.Jitter = 0.2
+	}
+	if len(cfg.RetryableCodes) == 0 {
+		cfg.RetryableCodes = []int32{503, 504}
+	}
+	if cfg.BudgetPercent <= 0 {
+		cfg.BudgetPercent = DefaultRetryBudgetPercent
+	}
 }
 
-func parserTimeDuration(num time.Duration, pec time.Duration, defValue time.Duration) time.Duration {
+// parserTimeDuration 为空时使用默认值，yaml 中不带单位的整数已在 unmarshal 中按毫秒处理
+func parserTimeDuration(num time.Duration, defValue time.Duration) time.Duration {
 	if num == 0 {
 		return defValue
 	}
-	return num * pec
+	return num
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// unmarshal 解析 yaml，兼容旧配置：time.Duration 字段写成不带单位的整数时按毫秒处理，如 reqTimeout: 3000 为 3s；
+// 带单位时按 "500ms"、"3s" 解析
+func unmarshal(r io.Reader, v any) error {
+	node := &yaml.Node{}
+	if err := yaml.NewDecoder(r).Decode(node); err != nil {
+		return err
+	}
+	convertDurations(node, reflect.TypeOf(v))
+	return node.Decode(v)
+}
+
+// convertDurations 按 t 的结构遍历 node，将对应 time.Duration 的整数改写为毫秒
+func convertDurations(node *yaml.Node, t reflect.Type) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			convertDurations(n, t)
+		}
+	case yaml.ScalarNode:
+		if t == durationType && node.ShortTag() == "!!int" {
+			node.Value += "ms"
+			node.Tag = "!!str"
+		}
+	case yaml.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for _, n := range node.Content {
+				convertDurations(n, t.Elem())
+			}
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			switch t.Kind() {
+			case reflect.Map:
+				convertDurations(node.Content[i+1], t.Elem())
+			case reflect.Struct:
+				if field, ok := yamlField(t, node.Content[i].Value); ok {
+					convertDurations(node.Content[i+1], field.Type)
+				}
+			}
+		}
+	}
+}
+
+// yamlField 按 yaml tag 查找字段，没有 tag 时与 yaml.v3 相同使用小写的字段名
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if name == key {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
 }
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		get  func(conf *Config) time.Duration
+		want time.Duration
+	}{
+		{"integer is milliseconds", "servantList:\n  - name: hello\n    reqTimeout: 3000\n",
+			func(conf *Config) time.Duration { return conf.ServantList[0].ReqTimeout }, 3 * time.Second},
+		{"string with unit", "servantList:\n  - name: hello\n    reqTimeout: 3s\n",
+			func(conf *Config) time.Duration { return conf.ServantList[0].ReqTimeout }, 3 * time.Second},
+		{"quoted integer is not converted", "servantList:\n  - name: hello\n    idleTimeout: \"0\"\n",
+			func(conf *Config) time.Duration { return conf.ServantList[0].IdleTimeout }, 0},
+		{"nested in slice", "servantList:\n  - name: hello\n    rateLimit:\n      rules:\n        - limit: 1\n          window: 200\n",
+			func(conf *Config) time.Duration { return conf.ServantList[0].RateLimit.Rules[0].Window }, 200 * time.Millisecond},
+		{"nested in map", "client:\n  hedge:\n    Get:\n      delay: 50\n",
+			func(conf *Config) time.Duration { return conf.ClientConf.Hedge["Get"].Delay }, 50 * time.Millisecond},
+		{"nested in pointer", "client:\n  retry:\n    initialBackoff: 1500ms\n    maxBackoff: 2000\n",
+			func(conf *Config) time.Duration { return conf.ClientConf.Retry.MaxBackoff }, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := &Config{}
+			if err := unmarshal(strings.NewReader(tt.yaml), conf); err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.get(conf); got != tt.want {
+				t.Fatalf("duration = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalNonDurationInteger(t *testing.T) {
+	conf := &Config{}
+	if err := unmarshal(strings.NewReader("servantList:\n  - name: hello\n    port: 10099\n    maxRequestNum: 10\n"), conf); err != nil {
+		t.Fatal(err)
+	}
+	if conf.ServantList[0].Port != "10099" || conf.ServantList[0].MaxRequestNum != 10 {
+		t.Fatalf("servant = %+v", conf.ServantList[0])
+	}
+}
+
+func TestParseRateLimitConf(t *testing.T) {
+	cfg, err := ParseRateLimitConf([]byte("rules:\n  - limit: 10\n    window: 100\n  - limit: 5\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Rules[0].Window != 100*time.Millisecond || cfg.Rules[1].Window != time.Second {
+		t.Fatalf("windows = %v, %v", cfg.Rules[0].Window, cfg.Rules[1].Window)
+	}
+	if cfg.Rules[0].Type != "token_bucket" || cfg.Rules[1].Burst != 5 {
+		t.Fatalf("rules = %+v, %+v", cfg.Rules[0], cfg.Rules[1])
+	}
+}
@@ -0,0 +1,301 @@
+package civet
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// jwksReloadInterval 检查 JWKS 文件是否修改的间隔
+const jwksReloadInterval = 10 * time.Second
+
+type jwtAuthenticator struct {
+	path     string
+	issuer   string
+	audience string
+	leeway   time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// NewJWTAuthenticator 使用本地 JWKS 文件中的 RSA 或 EC 公钥校验 Bearer JWT，sub 作为调用方；
+// 支持 RS256/384/512 与 ES256/384/512，没有 exp 的 token 被拒绝，issuer、audience 为空时不校验
+func NewJWTAuthenticator(jwksFile, issuer, audience string, leeway time.Duration) (Authenticator, error) {
+	a := &jwtAuthenticator{
+		path:     jwksFile,
+		issuer:   issuer,
+		audience: audience,
+		leeway:   leeway,
+	}
+	info, err := os.Stat(jwksFile)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := loadJWKS(jwksFile)
+	if err != nil {
+		return nil, err
+	}
+	a.keys, a.modTime, a.checkedAt = keys, info.ModTime(), time.Now()
+	return a, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func loadJWKS(path string) (map[string]crypto.PublicKey, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(bs, &set); err != nil {
+		return nil, fmt.Errorf("parse jwks %s: %w", path, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwks key %s: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bs), nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// getKey kid 为空且只有一个公钥时使用该公钥
+func (a *jwtAuthenticator) getKey(kid string) (crypto.PublicKey, bool) {
+	a.maybeReload()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// maybeReload 文件修改后重新加载，加载失败时继续使用原公钥
+func (a *jwtAuthenticator) maybeReload() {
+	a.mu.Lock()
+	if time.Since(a.checkedAt) < jwksReloadInterval {
+		a.mu.Unlock()
+		return
+	}
+	a.checkedAt = time.Now()
+	modTime := a.modTime
+	a.mu.Unlock()
+
+	info, err := os.Stat(a.path)
+	if err != nil || info.ModTime().Equal(modTime) {
+		return
+	}
+	keys, err := loadJWKS(a.path)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	a.keys, a.modTime = keys, info.ModTime()
+	a.mu.Unlock()
+}
+
+func (a *jwtAuthenticator) Authenticate(ctx context.Context, req *AuthRequest) (*Principal, error) {
+	token := bearerToken(req.Header)
+	if token == "" {
+		return nil, nil
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("jwt without sub")
+	}
+	return &Principal{Name: sub, Method: "jwt", Claims: claims}, nil
+}
+
+func (a *jwtAuthenticator) verify(token string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed jwt signature")
+	}
+	key, ok := a.getKey(header.Kid)
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt key %s", header.Kid)
+	}
+	if err = verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]any)
+	if err = decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("jwt without exp")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(a.leeway)) {
+		return nil, errors.New("jwt expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0).Add(-a.leeway)) {
+		return nil, errors.New("jwt not valid yet")
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		return nil, errors.New("invalid jwt issuer")
+	}
+	if a.audience != "" && !hasAudience(claims["aud"], a.audience) {
+		return nil, errors.New("invalid jwt audience")
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(s string, v any) error {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return errors.New("malformed jwt")
+	}
+	if err = json.Unmarshal(bs, v); err != nil {
+		return errors.New("malformed jwt")
+	}
+	return nil
+}
+
+// hasAudience aud 可以是字符串或字符串数组
+func hasAudience(aud any, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []any:
+		for _, a := range v {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported jwt alg %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return errors.New("jwt alg does not match key")
+		}
+		if rsa.VerifyPKCS1v15(k, hash, digest, sig) != nil {
+			return errors.New("invalid jwt signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(sig) != 2*size {
+			return errors.New("jwt alg does not match key")
+		}
+		r, s := new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid jwt signature")
+		}
+	default:
+		return errors.New("unsupported jwt key")
+	}
+	return nil
+}
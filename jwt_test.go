@@ -0,0 +1,157 @@
+package civet
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YCloud/civet/meta"
+)
+
+type jwtTestKeys struct {
+	rsa  *rsa.PrivateKey
+	ec   *ecdsa.PrivateKey
+	jwks string
+}
+
+func b64(bs []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+func newJWTTestKeys(t *testing.T) *jwtTestKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}}
+	bs, _ := json.Marshal(set)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err = os.WriteFile(path, bs, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &jwtTestKeys{rsa: rsaKey, ec: ecKey, jwks: path}
+}
+
+// sign alg 与 kid 写入 header，按 key 的类型签名，alg 与 key 不一致时用于测试校验
+func (k *jwtTestKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	var err error
+	switch kid {
+	case "ec":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	default:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:])
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(sig)
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	a, err := NewJWTAuthenticator(keys.jwks, "issuer", "civet", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	valid := func() map[string]any {
+		return map[string]any{"sub": "alice", "iss": "issuer", "aud": "civet", "exp": now + 60}
+	}
+	with := func(k string, v any) map[string]any {
+		claims := valid()
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+		return claims
+	}
+	tamper := func(token string) string {
+		parts := strings.Split(token, ".")
+		claims := valid()
+		claims["sub"] = "admin"
+		payload, _ := json.Marshal(claims)
+		return parts[0] + "." + b64(payload) + "." + parts[2]
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"rs256", keys.sign(t, "RS256", "rsa", valid()), ""},
+		{"es256", keys.sign(t, "ES256", "ec", valid()), ""},
+		{"audience list", keys.sign(t, "RS256", "rsa", with("aud", []string{"other", "civet"})), ""},
+		{"alg does not match rsa key", keys.sign(t, "ES256", "rsa", valid()), "jwt alg does not match key"},
+		{"alg does not match ec key", keys.sign(t, "RS256", "ec", valid()), "jwt alg does not match key"},
+		{"alg none", keys.sign(t, "none", "rsa", valid()), "unsupported jwt alg none"},
+		{"alg hs256", keys.sign(t, "HS256", "rsa", valid()), "unsupported jwt alg HS256"},
+		{"unknown kid", keys.sign(t, "RS256", "other", valid()), "unknown jwt key other"},
+		{"expired", keys.sign(t, "RS256", "rsa", with("exp", now-60)), "jwt expired"},
+		{"without exp", keys.sign(t, "RS256", "rsa", with("exp", nil)), "jwt without exp"},
+		{"not valid yet", keys.sign(t, "RS256", "rsa", with("nbf", now+60)), "jwt not valid yet"},
+		{"wrong issuer", keys.sign(t, "RS256", "rsa", with("iss", "other")), "invalid jwt issuer"},
+		{"wrong audience", keys.sign(t, "RS256", "rsa", with("aud", "other")), "invalid jwt audience"},
+		{"without sub", keys.sign(t, "RS256", "rsa", with("sub", nil)), "jwt without sub"},
+		{"tampered payload", tamper(keys.sign(t, "RS256", "rsa", valid())), "invalid jwt signature"},
+		{"malformed", "a.b", "malformed jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &AuthRequest{Route: "hello/SayHello", Header: mapHeader{meta.Authorization: "Bearer " + tt.token}}
+			p, err := a.Authenticate(context.Background(), req)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("err = %v, want %s", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != "alice" || p.Method != "jwt" {
+				t.Fatalf("principal = %+v", p)
+			}
+		})
+	}
+}
+
+func TestJWTAuthenticatorWithoutToken(t *testing.T) {
+	keys := newJWTTestKeys(t)
+	a, err := NewJWTAuthenticator(keys.jwks, "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := a.Authenticate(context.Background(), &AuthRequest{Header: mapHeader{}})
+	if p != nil || err != nil {
+		t.Fatalf("got %v, %v, want nil, nil", p, err)
+	}
+}
@@ -33,8 +33,18 @@ const (
 	MessageFlag_Req MessageFlag = 4
 	// 数据请求返回
 	MessageFlag_Resp MessageFlag = 5
-	//MessageFlag_Ping MessageFlag = 6
-	//MessageFlag_Ping MessageFlag = 7
+	// 打开流，由客户端发起，header 中携带客户端的接收窗口
+	MessageFlag_StreamOpen MessageFlag = 6
+	// 流数据
+	MessageFlag_StreamData MessageFlag = 7
+	// 流半关闭，发送方不再发送数据；服务端发送时表示流结束，可携带错误码
+	MessageFlag_StreamClose MessageFlag = 8
+	// 流控窗口更新，payload 为 32bit 的增量
+	MessageFlag_StreamWindow MessageFlag = 9
+	// 服务端即将关闭，客户端不再在该连接上发送新请求，进行中的请求继续等待响应
+	MessageFlag_GoAway MessageFlag = 10
+	// 客户端放弃请求或流，服务端取消对应 StreamId 的处理
+	MessageFlag_Cancel MessageFlag = 11
 )
 
 type Message struct {
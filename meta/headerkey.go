@@ -2,4 +2,33 @@ package meta
 
 const (
 	ContentType = "ContentType"
+	// 流的接收窗口大小
+	StreamWindow = "StreamWindow"
+	// 服务端推送消息的方法名
+	PushMethod = "PushMethod"
+	// 客户端剩余的超时时间，单位毫秒
+	Timeout = "Timeout"
+	// 调用方的服务名，app.server
+	Caller = "Caller"
+	// 认证，值为 "Bearer {token}"，token 可以是静态 token 或 JWT
+	Authorization = "Authorization"
+	// HMAC 签名认证，签名内容为 route、body 的 sha256 与 AuthSignedHeaders 中列出的 header，timestamp 为 unix 秒
+	AuthKeyId     = "AuthKeyId"
+	AuthTimestamp = "AuthTimestamp"
+	AuthNonce     = "AuthNonce"
+	AuthSignature = "AuthSignature"
+	// 参与签名的 header 名，以 ; 分隔
+	AuthSignedHeaders = "AuthSignedHeaders"
+	// 请求的优先级，服务端过载时先拒绝 low，critical 只对配置的调用方与路由生效，只受 MaxRequestNum 限制，为空时为 normal
+	Priority = "Priority"
+	// W3C trace-context，http 请求使用同名的 header
+	Traceparent = "traceparent"
+	Tracestate  = "tracestate"
+)
+
+// Priority 的取值
+const (
+	PriorityCritical = "critical"
+	PriorityNormal   = "normal"
+	PriorityLow      = "low"
 )
@@ -58,6 +58,18 @@ func FromMetaContextRespContext(ctx context.Context) (map[string]string, bool) {
 	return nil, false
 }
 
+type routeKey struct{}
+
+// NewRouteContext 保存服务端正在处理的路由，rpc 为 service/method，http 为 path
+func NewRouteContext(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+func RouteFromContext(ctx context.Context) (string, bool) {
+	route, ok := ctx.Value(routeKey{}).(string)
+	return route, ok
+}
+
 func CopyHeader(header map[string]string) map[string]string {
 	mp := make(map[string]string)
 	for k, v := range header {
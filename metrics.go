@@ -0,0 +1,206 @@
+package civet
+
+import (
+	"context"
+	errors2 "errors"
+	"github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/metrics"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	serverRequests = metrics.NewCounterVec("civet_server_requests_total",
+		"RPC requests handled by the server.", "servant", "route", "code")
+	serverDuration = metrics.NewHistogramVec("civet_server_request_duration_seconds",
+		"RPC request handling latency.", nil, "servant", "route")
+	serverRateLimited = metrics.NewCounterVec("civet_server_rate_limited_total",
+		"Requests rejected by rate limit rules.", "servant", "route")
+	serverShed = metrics.NewCounterVec("civet_server_shed_total",
+		"Requests rejected by the concurrency limit.", "servant", "priority")
+	serverBytesReceived = metrics.NewCounterVec("civet_server_bytes_received_total",
+		"Bytes read from RPC server connections.", "servant")
+	serverBytesSent = metrics.NewCounterVec("civet_server_bytes_sent_total",
+		"Bytes written to RPC server connections.", "servant")
+
+	clientRequests = metrics.NewCounterVec("civet_client_requests_total",
+		"RPC requests sent by the client, one per attempt.", "service", "route", "code")
+	clientDuration = metrics.NewHistogramVec("civet_client_request_duration_seconds",
+		"RPC request latency seen by the client.", nil, "service", "route")
+	clientBytesReceived = metrics.NewCounterVec("civet_client_bytes_received_total",
+		"Bytes read from RPC client connections.", "service")
+	clientBytesSent = metrics.NewCounterVec("civet_client_bytes_sent_total",
+		"Bytes written to RPC client connections.", "service")
+
+	httpRequests = metrics.NewCounterVec("civet_http_requests_total",
+		"HTTP requests handled by the server.", "servant", "method", "route", "code")
+	httpDuration = metrics.NewHistogramVec("civet_http_request_duration_seconds",
+		"HTTP request handling latency.", nil, "servant", "method", "route")
+	httpInflight = metrics.NewGaugeVec("civet_http_inflight_requests",
+		"HTTP requests currently being handled.", "servant")
+)
+
+// 连接数、队列长度等已有的状态在输出时采集
+func init() {
+	metrics.NewGaugeFunc("civet_server_inflight_requests", "RPC requests currently being handled.",
+		[]string{"servant"}, func(emit func(float64, ...string)) {
+			eachRpcServer(func(srv *rpcServer) {
+				emit(float64(srv.reqNum.Load()), srv.name)
+			})
+		})
+	metrics.NewGaugeFunc("civet_server_inflight_streams", "Streams currently open.",
+		[]string{"servant"}, func(emit func(float64, ...string)) {
+			eachRpcServer(func(srv *rpcServer) {
+				emit(float64(srv.streamNum.Load()), srv.name)
+			})
+		})
+	metrics.NewGaugeFunc("civet_server_queue_length", "Requests holding a concurrency slot.",
+		[]string{"servant"}, func(emit func(float64, ...string)) {
+			eachRpcServer(func(srv *rpcServer) {
+				emit(float64(srv.concurrency.inflight.Load()), srv.name)
+			})
+		})
+	metrics.NewGaugeFunc("civet_server_queue_capacity", "Current concurrency limit, adaptive or maxRequestNum.",
+		[]string{"servant"}, func(emit func(float64, ...string)) {
+			eachRpcServer(func(srv *rpcServer) {
+				emit(float64(srv.concurrency.current.Load()), srv.name)
+			})
+		})
+	metrics.NewGaugeFunc("civet_server_connections", "Open RPC server connections.",
+		[]string{"servant"}, func(emit func(float64, ...string)) {
+			eachRpcServer(func(srv *rpcServer) {
+				emit(float64(len(srv.getConns())), srv.name)
+			})
+		})
+	metrics.NewGaugeFunc("civet_client_connections", "Open connections in each client pool.",
+		[]string{"service", "endpoint"}, func(emit func(float64, ...string)) {
+			clients.Range(func(key, _ any) bool {
+				client := key.(*Client)
+				for addr, n := range client.poolConnNum() {
+					emit(float64(n), client.service, addr)
+				}
+				return true
+			})
+		})
+}
+
+func eachRpcServer(fn func(srv *rpcServer)) {
+	for _, srv := range app.servantList {
+		if rpc, ok := srv.(*rpcServer); ok {
+			fn(rpc)
+		}
+	}
+}
+
+// poolConnNum 每个节点连接池中的连接数，key 为 IPPort
+func (client *Client) poolConnNum() map[string]int {
+	client.mux.Lock()
+	pools := make([]*clientConnPool, 0, len(client.pools))
+	for _, pool := range client.pools {
+		pools = append(pools, pool)
+	}
+	client.mux.Unlock()
+	nums := make(map[string]int, len(pools))
+	for _, pool := range pools {
+		pool.mux.Lock()
+		nums[pool.addr] = len(pool.conn)
+		pool.mux.Unlock()
+	}
+	return nums
+}
+
+func errCode(err error) string {
+	if err == nil {
+		return "0"
+	}
+	return strconv.Itoa(int(errors.ParseError(err).Code))
+}
+
+func newMetricsServerInterceptor(servant string) ServerInterceptor {
+	return func(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) ([]byte, error) {
+		start := time.Now()
+		out, err := dispatch(ctx, impl, enc, method, in)
+		observeServerRequest(servant, method, start, err)
+		return out, err
+	}
+}
+
+// observeServerRequest 请求与流共用，流的耗时为从建立到关闭的整个生命周期
+func observeServerRequest(servant string, method string, start time.Time, err error) {
+	label := method
+	if errors2.Is(err, ErrUnknownMethod) {
+		label = "unknown"
+	}
+	serverDuration.With(servant, label).Observe(time.Since(start).Seconds())
+	serverRequests.With(servant, label, errCode(err)).Inc()
+}
+
+func newMetricsClientInterceptor(service string) ClientInterceptor {
+	return func(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any, invoker ClientInvoker) error {
+		start := time.Now()
+		err := invoker(ctx, ipport, reqMsg, enc, rsp)
+		observeClientRequest(service, reqMsg.Route, start, err)
+		return err
+	}
+}
+
+// observeClientRequest 请求与流共用
+func observeClientRequest(service string, route string, start time.Time, err error) {
+	clientDuration.With(service, route).Observe(time.Since(start).Seconds())
+	clientRequests.With(service, route, errCode(err)).Inc()
+}
+
+// httpRouteLabel handler 为 ServeMux 时使用匹配的 pattern，否则为 other，避免按原始路径产生大量时间序列
+func httpRouteLabel(handler http.Handler, req *http.Request) string {
+	if mux, ok := handler.(*http.ServeMux); ok {
+		if _, pattern := mux.Handler(req); pattern != "" {
+			return pattern
+		}
+	}
+	return "other"
+}
+
+func newMetricsHttpInterceptor(servant string, servantHandler http.Handler) HttpInterceptor {
+	return func(w http.ResponseWriter, req *http.Request, handler http.HandlerFunc) {
+		inflight := httpInflight.With(servant)
+		inflight.Inc()
+		defer inflight.Dec()
+		rw := wrapResponseWriter(w)
+		start := time.Now()
+		defer func() {
+			route := httpRouteLabel(servantHandler, req)
+			httpDuration.With(servant, req.Method, route).Observe(time.Since(start).Seconds())
+			httpRequests.With(servant, req.Method, route, strconv.Itoa(rw.Status())).Inc()
+		}()
+		handler(rw, req)
+	}
+}
+
+// countingConn 统计连接收发的字节数
+type countingConn struct {
+	net.Conn
+	received *metrics.Counter
+	sent     *metrics.Counter
+}
+
+func newCountingConn(conn net.Conn, received, sent *metrics.Counter) net.Conn {
+	return &countingConn{Conn: conn, received: received, sent: sent}
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.received.Add(float64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.sent.Add(float64(n))
+	}
+	return n, err
+}
@@ -19,19 +19,19 @@ var ErrMaxBytes = errors.New("max bytes")
 func ParserRequest(bs []byte) (*Request, error) {
 	l := len(bs)
 	r := 0
-	if r+4 >= l {
+	if r+4 > l {
 		return nil, ErrNotEnoughBytes
 	}
 	req := &Request{}
 	req.StreamId = int32(binary.LittleEndian.Uint32(bs[r:]))
 	r += 4
-	if r+1 >= l {
+	if r+1 > l {
 		return nil, ErrNotEnoughBytes
 	}
 	flag := bs[r]
 	r += 1
 	req.Flag = MessageFlag(flag & MessageFlagMask)
-	if r+2 >= l {
+	if r+2 > l {
 		return nil, ErrNotEnoughBytes
 	}
 	routeSize := binary.LittleEndian.Uint16(bs[r:])
@@ -41,7 +41,7 @@ func ParserRequest(bs []byte) (*Request, error) {
 	}
 	req.Route = string(bs[r : r+int(routeSize)])
 	r += int(routeSize)
-	if r+3 >= l {
+	if r+3 > l {
 		return nil, ErrNotEnoughBytes
 	}
 	headerSize := int(bs[r]) | int(bs[r+1])<<8 | int(bs[r+2])<<16
@@ -92,13 +92,13 @@ func MarshalRequest(req *Request) ([]byte, error) {
 func ParserResponse(bs []byte) (*Response, error) {
 	l := len(bs)
 	r := 0
-	if r+4 >= l {
+	if r+4 > l {
 		return nil, ErrNotEnoughBytes
 	}
 	rsp := &Response{}
 	rsp.StreamId = int32(binary.LittleEndian.Uint32(bs[r:]))
 	r += 4
-	if r+1 >= l {
+	if r+1 > l {
 		return nil, ErrNotEnoughBytes
 	}
 	flag := bs[r]
@@ -106,12 +106,12 @@ func ParserResponse(bs []byte) (*Response, error) {
 	rsp.Flag = MessageFlag(flag & MessageFlagMask)
 	codeBit := flag & MessageCodeMask
 	if codeBit > 0 {
-		if r+4 >= l {
+		if r+4 > l {
 			return nil, ErrNotEnoughBytes
 		}
 		rsp.Code = int32(binary.LittleEndian.Uint32(bs[r:]))
 		r += 4
-		if r+2 >= l {
+		if r+2 > l {
 			return nil, ErrNotEnoughBytes
 		}
 		codeDescSize := binary.LittleEndian.Uint16(bs[r:])
@@ -122,7 +122,7 @@ func ParserResponse(bs []byte) (*Response, error) {
 		rsp.CodeDesc = string(bs[r : r+int(codeDescSize)])
 		r += int(codeDescSize)
 	}
-	if r+3 >= l {
+	if r+3 > l {
 		return nil, ErrNotEnoughBytes
 	}
 	headerSize := int(bs[r]) | int(bs[r+1])<<8 | int(bs[r+2])<<16
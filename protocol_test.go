@@ -0,0 +1,105 @@
+package civet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *Request
+	}{
+		{"ping", &Request{StreamId: 1, Flag: MessageFlag_Ping}},
+		{"cancel", &Request{StreamId: 2, Flag: MessageFlag_Cancel}},
+		{"stream close", &Request{StreamId: 3, Flag: MessageFlag_StreamClose}},
+		{"stream window", &Request{StreamId: 4, Flag: MessageFlag_StreamWindow, Body: windowBody(8)}},
+		{"stream open", &Request{StreamId: 5, Flag: MessageFlag_StreamOpen, Route: "hello/Chat", Header: map[string]string{"ContentType": "json"}}},
+		{"request", &Request{StreamId: 6, Flag: MessageFlag_Req, Route: "hello/SayHello", Header: map[string]string{"a": "1", "b": "2"}, Body: []byte(`{"name":"civet"}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs, err := MarshalRequest(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := binary.LittleEndian.Uint32(bs); int(n) != len(bs) {
+				t.Fatalf("length = %d, want %d", n, len(bs))
+			}
+			// 连接读取时去掉长度前缀
+			got, err := ParserRequest(bs[4:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.StreamId != tt.req.StreamId || got.Flag != tt.req.Flag || got.Route != tt.req.Route {
+				t.Fatalf("request = %+v, want %+v", got, tt.req)
+			}
+			if !bytes.Equal(got.Body, tt.req.Body) {
+				t.Fatalf("body = %q, want %q", got.Body, tt.req.Body)
+			}
+			if len(got.Header) != len(tt.req.Header) {
+				t.Fatalf("header = %v, want %v", got.Header, tt.req.Header)
+			}
+			for k, v := range tt.req.Header {
+				if got.Header[k] != v {
+					t.Fatalf("header = %v, want %v", got.Header, tt.req.Header)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		rsp  *Response
+	}{
+		{"ping resp", &Response{StreamId: 1, Flag: MessageFlag_PingResp}},
+		{"go away", &Response{StreamId: 0, Flag: MessageFlag_GoAway}},
+		{"stream close", &Response{StreamId: 3, Flag: MessageFlag_StreamClose}},
+		{"stream close with code", &Response{StreamId: 3, Flag: MessageFlag_StreamClose, Code: 503, CodeDesc: "server overloaded"}},
+		{"code without desc", &Response{StreamId: 4, Flag: MessageFlag_Resp, Code: 500}},
+		{"response", &Response{StreamId: 5, Flag: MessageFlag_Resp, Header: map[string]string{"a": "1"}, Body: []byte(`{}`)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bs, err := MarshalResponse(tt.rsp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := binary.LittleEndian.Uint32(bs); int(n) != len(bs) {
+				t.Fatalf("length = %d, want %d", n, len(bs))
+			}
+			got, err := ParserResponse(bs[4:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.StreamId != tt.rsp.StreamId || got.Flag != tt.rsp.Flag || got.Code != tt.rsp.Code || got.CodeDesc != tt.rsp.CodeDesc {
+				t.Fatalf("response = %+v, want %+v", got, tt.rsp)
+			}
+			if !bytes.Equal(got.Body, tt.rsp.Body) {
+				t.Fatalf("body = %q, want %q", got.Body, tt.rsp.Body)
+			}
+			if len(got.Header) != len(tt.rsp.Header) {
+				t.Fatalf("header = %v, want %v", got.Header, tt.rsp.Header)
+			}
+		})
+	}
+}
+
+func TestParserTruncated(t *testing.T) {
+	req, _ := MarshalRequest(&Request{StreamId: 1, Flag: MessageFlag_Req, Route: "hello/SayHello", Header: map[string]string{"a": "1"}})
+	rsp, _ := MarshalResponse(&Response{StreamId: 1, Flag: MessageFlag_Resp, Code: 500, CodeDesc: "internal error", Header: map[string]string{"a": "1"}})
+	// 没有 body 时截掉任意字节都不完整
+	for n := 0; n < len(req)-4; n++ {
+		if _, err := ParserRequest(req[4 : 4+n]); err != ErrNotEnoughBytes {
+			t.Fatalf("request truncated to %d bytes: err = %v, want ErrNotEnoughBytes", n, err)
+		}
+	}
+	for n := 0; n < len(rsp)-4; n++ {
+		if _, err := ParserResponse(rsp[4 : 4+n]); err != ErrNotEnoughBytes {
+			t.Fatalf("response truncated to %d bytes: err = %v, want ErrNotEnoughBytes", n, err)
+		}
+	}
+}
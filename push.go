@@ -0,0 +1,145 @@
+package civet
+
+import (
+	"context"
+	"github.com/YCloud/civet/meta"
+	"github.com/YCloud/civet/tlog"
+	"net"
+)
+
+type pusherKey struct{}
+
+// Pusher 服务端向客户端连接推送消息，可在请求结束后保存下来继续使用
+type Pusher struct {
+	sc  *serverConn
+	enc Encoder
+}
+
+func newPusherContext(ctx context.Context, sc *serverConn, enc Encoder) context.Context {
+	return context.WithValue(ctx, pusherKey{}, &Pusher{sc: sc, enc: enc})
+}
+
+// PusherFromContext 获取当前请求所在连接的 Pusher
+func PusherFromContext(ctx context.Context) (*Pusher, bool) {
+	p, ok := ctx.Value(pusherKey{}).(*Pusher)
+	return p, ok
+}
+
+// Push 推送消息，客户端通过 WithClientPushHandler 注册的 method 处理
+func (p *Pusher) Push(method string, v any) error {
+	if p.Closed() {
+		return ErrBadConn
+	}
+	body, err := p.enc.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return p.sc.sendResponse(&Response{
+		Flag: MessageFlag_Push,
+		Header: map[string]string{
+			meta.ContentType: p.enc.Name(),
+			meta.PushMethod:  method,
+		},
+		Body: body,
+	})
+}
+
+func (p *Pusher) Closed() bool {
+	return p.sc.isClose.Load()
+}
+
+func (p *Pusher) RemoteAddr() net.Addr {
+	return p.sc.conn.RemoteAddr()
+}
+
+// PushHandler 客户端处理服务端推送的消息，in 使用 enc 解码
+type PushHandler func(ctx context.Context, enc Encoder, in []byte)
+
+func WithClientPushHandler(method string, handler PushHandler) ClientOption {
+	return func(client *Client) {
+		client.HandlePush(method, handler)
+	}
+}
+
+// HandlePush 注册服务端推送消息的处理函数
+func (client *Client) HandlePush(method string, handler PushHandler) {
+	client.pushMux.Lock()
+	defer client.pushMux.Unlock()
+	client.pushHandlers[method] = handler
+}
+
+// Send 向服务端推送消息，不等待服务端处理结果
+func (client *Client) Send(ctx context.Context, method string, ipport string, req any, options ...ClientCallOption) error {
+	callOptions := &clientCallOptions{}
+	for _, option := range options {
+		option(callOptions)
+	}
+
+	reqHeader, ok := meta.FromMetaContextReqContext(ctx)
+	if !ok {
+		reqHeader = make(map[string]string)
+	}
+	enc, err := client.getEncoder(callOptions, reqHeader)
+	if err != nil {
+		return err
+	}
+	reqBytes, err := enc.Marshal(req)
+	if err != nil {
+		return err
+	}
+	reqHeader = meta.CopyHeader(reqHeader)
+	reqHeader[meta.ContentType] = enc.Name()
+	reqHeader[meta.Caller] = client.caller
+
+	reqMsg := &Request{
+		StreamId: client.reqId.Add(1),
+		Flag:     MessageFlag_Push,
+		Route:    client.getRoute(method),
+		Header:   reqHeader,
+		Body:     reqBytes,
+	}
+
+	interceptorFun := client.unaryInterceptor
+	if interceptorFun != nil {
+		return interceptorFun(ctx, ipport, reqMsg, enc, nil, client.sendInvoker)
+	}
+	return client.sendInvoker(ctx, ipport, reqMsg, enc, nil)
+}
+
+func (client *Client) sendInvoker(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any) error {
+	if err := setTimeoutHeader(ctx, reqMsg.Header); err != nil {
+		return err
+	}
+	if err := client.applyCredentials(reqMsg); err != nil {
+		return err
+	}
+	reqMsgBytes, err := MarshalRequest(reqMsg)
+	if err != nil {
+		return err
+	}
+	clientConn, done, err := client.getConn(ctx, ipport, reqMsg)
+	if err != nil {
+		return err
+	}
+	_, err = clientConn.conn.Write(reqMsgBytes)
+	done(err)
+	return err
+}
+
+func (client *Client) handlePush(rspMsg *Response) {
+	method := rspMsg.Header[meta.PushMethod]
+	client.pushMux.Lock()
+	handler, ok := client.pushHandlers[method]
+	client.pushMux.Unlock()
+	if !ok {
+		tlog.Warn("push handler not found", tlog.Any("service", client.service), tlog.Any("method", method))
+		return
+	}
+	enc := GetEncoder(rspMsg.Header[meta.ContentType])
+	if enc == nil {
+		tlog.Warn("push content type error", tlog.Any("service", client.service), tlog.Any("method", method))
+		return
+	}
+	ctx := meta.NewMetaContextWithReqContext(context.Background(), rspMsg.Header)
+	go handler(ctx, enc, rspMsg.Body)
+}
@@ -0,0 +1,268 @@
+package civet
+
+import (
+	"context"
+	"fmt"
+	"github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/meta"
+	"github.com/YCloud/civet/tlog"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// limiterIdleTimeout 按 Key 限流时，超过该时间没有请求的 key 会被清理
+const limiterIdleTimeout = time.Minute
+
+// rateLimitKeyPrincipal Key 为该值时按认证后的调用方限流
+const rateLimitKeyPrincipal = "principal"
+
+type limiter interface {
+	allow(now time.Time) bool
+}
+
+// tokenBucket 以 Limit/Window 的速率补充令牌，最多积攒 Burst 个
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// slidingWindow 按上一个窗口在当前滑动窗口中所占的比例估算请求数
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+	start  time.Time
+	prev   int
+	curr   int
+}
+
+func (w *slidingWindow) allow(now time.Time) bool {
+	if elapsed := now.Sub(w.start); elapsed >= w.window {
+		n := elapsed / w.window
+		if n == 1 {
+			w.prev = w.curr
+		} else {
+			w.prev = 0
+		}
+		w.curr = 0
+		w.start = w.start.Add(n * w.window)
+	}
+	weight := 1 - float64(now.Sub(w.start))/float64(w.window)
+	if float64(w.prev)*weight+float64(w.curr) >= float64(w.limit) {
+		return false
+	}
+	w.curr++
+	return true
+}
+
+type keyedLimiter struct {
+	limiter
+	lastUsed time.Time
+}
+
+type rateLimitRule struct {
+	cfg *config.RateLimitRule
+
+	mu        sync.Mutex
+	limiters  map[string]*keyedLimiter
+	lastSweep time.Time
+}
+
+func newRateLimitRule(cfg *config.RateLimitRule) (*rateLimitRule, error) {
+	if cfg.Limit <= 0 {
+		return nil, fmt.Errorf("rate limit of route %q must be positive", cfg.Route)
+	}
+	if cfg.Type != "token_bucket" && cfg.Type != "sliding_window" {
+		return nil, fmt.Errorf("unknown rate limit type %s", cfg.Type)
+	}
+	return &rateLimitRule{
+		cfg:       cfg,
+		limiters:  make(map[string]*keyedLimiter),
+		lastSweep: time.Now(),
+	}, nil
+}
+
+func (r *rateLimitRule) newLimiter(now time.Time) limiter {
+	if r.cfg.Type == "sliding_window" {
+		return &slidingWindow{limit: r.cfg.Limit, window: r.cfg.Window, start: now}
+	}
+	return &tokenBucket{
+		rate:   float64(r.cfg.Limit) / r.cfg.Window.Seconds(),
+		burst:  float64(r.cfg.Burst),
+		tokens: float64(r.cfg.Burst),
+		last:   now,
+	}
+}
+
+// matchRoute 空与 * 匹配所有路由，以 /* 结尾时按前缀匹配
+func matchRoute(pattern, route string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	if strings.HasSuffix(pattern, "/*") {
+		return strings.HasPrefix(route, pattern[:len(pattern)-1])
+	}
+	return pattern == route
+}
+
+// label 规则的路由，用作监控的 route 标签
+func (r *rateLimitRule) label() string {
+	if r.cfg.Route == "" {
+		return "*"
+	}
+	return r.cfg.Route
+}
+
+func (r *rateLimitRule) allow(now time.Time, route string, key string) bool {
+	if !matchRoute(r.cfg.Route, route) {
+		return true
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.lastSweep) > limiterIdleTimeout {
+		for k, l := range r.limiters {
+			if now.Sub(l.lastUsed) > limiterIdleTimeout && now.Sub(l.lastUsed) > r.cfg.Window {
+				delete(r.limiters, k)
+			}
+		}
+		r.lastSweep = now
+	}
+	l, ok := r.limiters[key]
+	if !ok {
+		l = &keyedLimiter{limiter: r.newLimiter(now)}
+		r.limiters[key] = l
+	}
+	l.lastUsed = now
+	return l.allow(now)
+}
+
+// rateLimiter servant 的限流规则，规则可以在运行时整体替换，替换后重新计数
+type rateLimiter struct {
+	servant string
+	cfg     atomic.Pointer[config.RateLimitConf]
+	rules   atomic.Pointer[[]*rateLimitRule]
+}
+
+func newRateLimiter(servant string, cfg *config.RateLimitConf) (*rateLimiter, error) {
+	l := &rateLimiter{servant: servant}
+	if err := l.update(cfg); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// update cfg 为 nil 时取消限流；规则有误时保留原规则
+func (l *rateLimiter) update(cfg *config.RateLimitConf) error {
+	if cfg == nil {
+		cfg = &config.RateLimitConf{}
+	}
+	rules := make([]*rateLimitRule, 0, len(cfg.Rules))
+	for _, ruleCfg := range cfg.Rules {
+		rule, err := newRateLimitRule(ruleCfg)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	l.cfg.Store(cfg)
+	l.rules.Store(&rules)
+	return nil
+}
+
+func (l *rateLimiter) config() *config.RateLimitConf {
+	return l.cfg.Load()
+}
+
+// allow 认证前检查，按 principal 限流的规则之外所有匹配的规则都通过时返回 true，
+// 被拒绝的请求按规则的路由计入 civet_server_rate_limited_total
+func (l *rateLimiter) allow(route string, header AuthHeader) bool {
+	now := time.Now()
+	for _, rule := range *l.rules.Load() {
+		if rule.cfg.Key == rateLimitKeyPrincipal {
+			continue
+		}
+		key := ""
+		if rule.cfg.Key != "" {
+			key = header.Get(rule.cfg.Key)
+		}
+		if !rule.allow(now, route, key) {
+			serverRateLimited.With(l.servant, rule.label()).Inc()
+			return false
+		}
+	}
+	return true
+}
+
+// allowPrincipal 认证后检查按 principal 限流的规则，未认证的请求共用一个限流器
+func (l *rateLimiter) allowPrincipal(ctx context.Context, route string) bool {
+	now := time.Now()
+	for _, rule := range *l.rules.Load() {
+		if rule.cfg.Key != rateLimitKeyPrincipal {
+			continue
+		}
+		key := ""
+		if principal, ok := PrincipalFromContext(ctx); ok {
+			key = principal.Name
+		}
+		if !rule.allow(now, route, key) {
+			serverRateLimited.With(l.servant, rule.label()).Inc()
+			return false
+		}
+	}
+	return true
+}
+
+// serverInterceptor 位于认证拦截器之后
+func (l *rateLimiter) serverInterceptor(ctx context.Context, impl any, enc Encoder, method string, in []byte, dispatch Dispatch) ([]byte, error) {
+	route, _ := meta.RouteFromContext(ctx)
+	if !l.allowPrincipal(ctx, route) {
+		return nil, errors.ErrRateLimited
+	}
+	return dispatch(ctx, impl, enc, method, in)
+}
+
+// httpInterceptor 位于认证拦截器之后
+func (l *rateLimiter) httpInterceptor(w http.ResponseWriter, req *http.Request, handler http.HandlerFunc) {
+	route, _ := meta.RouteFromContext(req.Context())
+	if !l.allowPrincipal(req.Context(), route) {
+		e := errors.ParseError(errors.ErrRateLimited)
+		http.Error(w, e.Desc, int(e.Code))
+		return
+	}
+	handler(w, req)
+}
+
+// reloadRateLimits 配置重新加载后更新所有 servant 的限流规则
+func reloadRateLimits(cfg *config.Config) {
+	for _, servantCfg := range cfg.ServantList {
+		var limiter *rateLimiter
+		switch srv := getServant(servantCfg.Name).(type) {
+		case *rpcServer:
+			limiter = srv.rateLimiter
+		case *httpServer:
+			limiter = srv.rateLimiter
+		}
+		if limiter == nil {
+			continue
+		}
+		if err := limiter.update(servantCfg.RateLimit); err != nil {
+			tlog.Error("reload rate limit failed", tlog.Any("servant", servantCfg.Name), tlog.Any("err", err))
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package civet
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/meta"
+)
+
+// limiterStep 距离开始的时间与期望的结果
+type limiterStep struct {
+	at   time.Duration
+	want bool
+}
+
+func runLimiterSteps(t *testing.T, l limiter, start time.Time, steps []limiterStep) {
+	t.Helper()
+	for i, step := range steps {
+		if got := l.allow(start.Add(step.at)); got != step.want {
+			t.Fatalf("step %d at %v: allow = %v, want %v", i, step.at, got, step.want)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	tests := []struct {
+		name  string
+		rate  float64
+		burst float64
+		steps []limiterStep
+	}{
+		{"burst then reject", 10, 3, []limiterStep{{0, true}, {0, true}, {0, true}, {0, false}}},
+		{"refill at rate", 10, 3, []limiterStep{
+			{0, true}, {0, true}, {0, true}, {50 * time.Millisecond, false}, {100 * time.Millisecond, true}, {100 * time.Millisecond, false}}},
+		{"refill capped at burst", 10, 2, []limiterStep{
+			{0, true}, {0, true}, {10 * time.Second, true}, {10 * time.Second, true}, {10 * time.Second, false}}},
+		{"steady rate", 1, 1, []limiterStep{
+			{0, true}, {time.Second, true}, {2 * time.Second, true}, {2500 * time.Millisecond, false}, {3 * time.Second, true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			runLimiterSteps(t, &tokenBucket{rate: tt.rate, burst: tt.burst, tokens: tt.burst, last: start}, start, tt.steps)
+		})
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		steps []limiterStep
+	}{
+		{"limit in window", 2, []limiterStep{{0, true}, {100 * time.Millisecond, true}, {900 * time.Millisecond, false}}},
+		{"previous window weighted", 2, []limiterStep{
+			// 上一个窗口的 2 个请求在 1.5s 时按一半计入
+			{0, true}, {0, true}, {1500 * time.Millisecond, true}, {1500 * time.Millisecond, false}}},
+		{"previous window decays", 2, []limiterStep{
+			{0, true}, {0, true}, {1100 * time.Millisecond, true}, {1100 * time.Millisecond, false}, {1900 * time.Millisecond, true}}},
+		{"idle windows reset", 2, []limiterStep{
+			{0, true}, {0, true}, {5 * time.Second, true}, {5 * time.Second, true}, {5 * time.Second, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			runLimiterSteps(t, &slidingWindow{limit: tt.limit, window: time.Second, start: start}, start, tt.steps)
+		})
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		pattern string
+		route   string
+		want    bool
+	}{
+		{"", "hello/SayHello", true},
+		{"*", "/api/users", true},
+		{"hello/*", "hello/SayHello", true},
+		{"hello/*", "hello2/SayHello", false},
+		{"hello/SayHello", "hello/SayHello", true},
+		{"hello/SayHello", "hello/SayHi", false},
+		{"/api/*", "/api/users/1", true},
+		{"/api/*", "/apiv2/users", false},
+	}
+	for _, tt := range tests {
+		if got := matchRoute(tt.pattern, tt.route); got != tt.want {
+			t.Fatalf("matchRoute(%q, %q) = %v, want %v", tt.pattern, tt.route, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   *config.RateLimitRule
+		route  string
+		caller []string
+		want   []bool
+	}{
+		{"route limited", &config.RateLimitRule{Type: "token_bucket", Route: "hello/*", Limit: 2, Window: time.Minute, Burst: 2},
+			"hello/SayHello", []string{"a", "b", "c"}, []bool{true, true, false}},
+		{"other route", &config.RateLimitRule{Type: "token_bucket", Route: "hello/SayHi", Limit: 1, Window: time.Minute, Burst: 1},
+			"hello/SayHello", []string{"a", "a", "a"}, []bool{true, true, true}},
+		{"per caller", &config.RateLimitRule{Type: "sliding_window", Key: meta.Caller, Limit: 1, Window: time.Minute},
+			"hello/SayHello", []string{"a", "b", "a", "c", "b"}, []bool{true, true, false, true, false}},
+		{"principal rule skipped", &config.RateLimitRule{Type: "token_bucket", Key: "principal", Limit: 1, Window: time.Minute, Burst: 1},
+			"hello/SayHello", []string{"a", "a", "a"}, []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newRateLimiter("hello", &config.RateLimitConf{Rules: []*config.RateLimitRule{tt.rule}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, caller := range tt.caller {
+				if got := l.allow(tt.route, mapHeader{meta.Caller: caller}); got != tt.want[i] {
+					t.Fatalf("request %d from %s: allow = %v, want %v", i, caller, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterAllowPrincipal(t *testing.T) {
+	l, err := newRateLimiter("hello", &config.RateLimitConf{Rules: []*config.RateLimitRule{
+		{Type: "token_bucket", Key: "principal", Limit: 1, Window: time.Minute, Burst: 1},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPrincipal := func(name string) context.Context {
+		return newPrincipalContext(context.Background(), &Principal{Name: name})
+	}
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want bool
+	}{
+		{"alice", withPrincipal("alice"), true},
+		{"bob", withPrincipal("bob"), true},
+		{"alice again", withPrincipal("alice"), false},
+		{"anonymous", context.Background(), true},
+		// 未认证的请求共用一个限流器
+		{"anonymous again", context.Background(), false},
+	}
+	for _, tt := range tests {
+		if got := l.allowPrincipal(tt.ctx, "hello/SayHello"); got != tt.want {
+			t.Fatalf("%s: allowPrincipal = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	// 认证前的检查跳过按 principal 的规则
+	if !l.allow("hello/SayHello", mapHeader{}) {
+		t.Fatal("allow rejected by principal rule")
+	}
+}
+
+func TestRateLimiterUpdate(t *testing.T) {
+	rule := &config.RateLimitRule{Type: "token_bucket", Limit: 1, Window: time.Minute, Burst: 1}
+	l, err := newRateLimiter("hello", &config.RateLimitConf{Rules: []*config.RateLimitRule{rule}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.allow("hello/SayHello", mapHeader{}) || l.allow("hello/SayHello", mapHeader{}) {
+		t.Fatal("limit 1 not applied")
+	}
+	// 规则有误时保留原规则
+	if err := l.update(&config.RateLimitConf{Rules: []*config.RateLimitRule{{Type: "leaky", Limit: 1}}}); err == nil {
+		t.Fatal("unknown type accepted")
+	}
+	if err := l.update(&config.RateLimitConf{Rules: []*config.RateLimitRule{{Type: "token_bucket", Limit: 0}}}); err == nil {
+		t.Fatal("zero limit accepted")
+	}
+	if l.allow("hello/SayHello", mapHeader{}) {
+		t.Fatal("old rule lost after invalid update")
+	}
+	// 替换规则后重新计数
+	if err := l.update(&config.RateLimitConf{Rules: []*config.RateLimitRule{rule}}); err != nil {
+		t.Fatal(err)
+	}
+	if !l.allow("hello/SayHello", mapHeader{}) {
+		t.Fatal("rule not reset after update")
+	}
+	// nil 取消限流
+	if err := l.update(nil); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if !l.allow("hello/SayHello", mapHeader{}) {
+			t.Fatal("rejected after rate limit removed")
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package civet
+
+import (
+	"context"
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Registry 服务注册，Run 启动所有 servant 后注册，停止时先注销再停止 servant
+type Registry interface {
+	Register(ctx context.Context, service string, endpoint *Endpoint) error
+	Deregister(ctx context.Context, service string, endpoint *Endpoint) error
+}
+
+// SetRegistry 设置服务注册，需在 Run 之前调用
+func SetRegistry(registry Registry) {
+	app.registry = registry
+}
+
+// MemoryRegistry 进程内的服务注册，同时实现了 Resolver，主要用于测试
+type MemoryRegistry struct {
+	mu       sync.Mutex
+	services map[string]map[string]*Endpoint
+	watchers map[string][]*memoryWatcher
+}
+
+func NewMemoryRegistry() *MemoryRegistry {
+	return &MemoryRegistry{
+		services: make(map[string]map[string]*Endpoint),
+		watchers: make(map[string][]*memoryWatcher),
+	}
+}
+
+func (r *MemoryRegistry) Register(ctx context.Context, service string, endpoint *Endpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	endpoints, ok := r.services[service]
+	if !ok {
+		endpoints = make(map[string]*Endpoint)
+		r.services[service] = endpoints
+	}
+	endpoints[endpoint.IPPort()] = endpoint
+	r.notify(service, &ResolverEvent{Type: ResolverEvent_Add, Endpoint: endpoint})
+	return nil
+}
+
+func (r *MemoryRegistry) Deregister(ctx context.Context, service string, endpoint *Endpoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ipport := endpoint.IPPort()
+	if _, ok := r.services[service][ipport]; !ok {
+		return nil
+	}
+	delete(r.services[service], ipport)
+	r.notify(service, &ResolverEvent{Type: ResolverEvent_Remove, Endpoint: endpoint})
+	return nil
+}
+
+func (r *MemoryRegistry) Watch(ctx context.Context, service string) (<-chan *ResolverEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := &memoryWatcher{
+		ch:   make(chan *ResolverEvent, len(r.services[service])+64),
+		wake: make(chan struct{}, 1),
+	}
+	// 首次结果在返回前放入 chan，调用方可以立即拿到
+	for _, endpoint := range r.services[service] {
+		w.ch <- &ResolverEvent{Type: ResolverEvent_Add, Endpoint: endpoint}
+	}
+	r.watchers[service] = append(r.watchers[service], w)
+
+	go func() {
+		w.run(ctx)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		watchers := r.watchers[service]
+		for i := range watchers {
+			if watchers[i] == w {
+				r.watchers[service] = append(watchers[:i], watchers[i+1:]...)
+				break
+			}
+		}
+	}()
+	return w.ch, nil
+}
+
+// notify 调用方持有 r.mu
+func (r *MemoryRegistry) notify(service string, ev *ResolverEvent) {
+	for _, w := range r.watchers[service] {
+		w.push(ev)
+	}
+}
+
+// memoryWatcher 事件先放入 queue，由 run 按顺序写入 ch；消费方处理慢时事件在 queue 中等待，
+// 不丢弃节点变化，也不阻塞注册
+type memoryWatcher struct {
+	ch   chan *ResolverEvent
+	wake chan struct{}
+
+	mu    sync.Mutex
+	queue []*ResolverEvent
+}
+
+func (w *memoryWatcher) push(ev *ResolverEvent) {
+	w.mu.Lock()
+	w.queue = append(w.queue, ev)
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run ctx 取消后关闭 ch
+func (w *memoryWatcher) run(ctx context.Context) {
+	defer close(w.ch)
+	for {
+		w.mu.Lock()
+		queue := w.queue
+		w.queue = nil
+		w.mu.Unlock()
+		for _, ev := range queue {
+			select {
+			case w.ch <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		select {
+		case <-w.wake:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// FileRegistry 将节点写入 yaml 或 json 文件，格式与 NewFileResolver 相同，多个进程通过文件锁共享同一个文件
+type FileRegistry struct {
+	path string
+}
+
+func NewFileRegistry(path string) *FileRegistry {
+	return &FileRegistry{path: path}
+}
+
+func (r *FileRegistry) Register(ctx context.Context, service string, endpoint *Endpoint) error {
+	return r.update(func(services map[string][]*Endpoint) {
+		endpoints := removeEndpoint(services[service], endpoint)
+		services[service] = append(endpoints, endpoint)
+	})
+}
+
+func (r *FileRegistry) Deregister(ctx context.Context, service string, endpoint *Endpoint) error {
+	return r.update(func(services map[string][]*Endpoint) {
+		endpoints := removeEndpoint(services[service], endpoint)
+		if len(endpoints) == 0 {
+			delete(services, service)
+		} else {
+			services[service] = endpoints
+		}
+	})
+}
+
+func (r *FileRegistry) update(fn func(services map[string][]*Endpoint)) error {
+	lock, err := os.OpenFile(r.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	services, err := readEndpointFile(r.path)
+	if os.IsNotExist(err) {
+		services, err = make(map[string][]*Endpoint), nil
+	}
+	if err != nil {
+		return err
+	}
+	fn(services)
+
+	var bs []byte
+	if filepath.Ext(r.path) == ".json" {
+		bs, err = json.MarshalIndent(services, "", "  ")
+	} else {
+		bs, err = yaml.Marshal(services)
+	}
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，Resolver 不会读到写了一半的文件
+	tmp := r.path + ".tmp"
+	if err = os.WriteFile(tmp, bs, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func removeEndpoint(endpoints []*Endpoint, endpoint *Endpoint) []*Endpoint {
+	ipport := endpoint.IPPort()
+	list := make([]*Endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.IPPort() != ipport {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+// registerEndpoint 注册到 Registry 的节点，监听所有网卡时使用本机第一个非回环地址
+func registerEndpoint(srv Server) *Endpoint {
+	endpoint := *srv.Endpoint()
+	if endpoint.IP == "" || endpoint.IP == "0.0.0.0" || endpoint.IP == "::" {
+		endpoint.IP = localIP()
+	}
+	return &endpoint
+}
+
+func localIP() string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return "127.0.0.1"
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && ipNet.IP.To4() != nil {
+			return ipNet.IP.String()
+		}
+	}
+	return "127.0.0.1"
+}
@@ -0,0 +1,81 @@
+package civet
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryRegistrySlowWatcher(t *testing.T) {
+	tests := []struct {
+		name       string
+		register   int
+		deregister int
+	}{
+		{"within chan buffer", 10, 5},
+		{"exceeds chan buffer", 200, 150},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewMemoryRegistry()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// 已有的节点在 Watch 返回前放入 chan
+			r.Register(ctx, "hello", &Endpoint{IP: "127.0.0.1", Port: "9999"})
+			ch, err := r.Watch(ctx, "hello")
+			if err != nil {
+				t.Fatal(err)
+			}
+			endpoint := func(i int) *Endpoint {
+				return &Endpoint{IP: "127.0.0.1", Port: strconv.Itoa(10000 + i)}
+			}
+			// 不消费 chan，注册与注销不能阻塞，也不能丢弃事件
+			for i := 0; i < tt.register; i++ {
+				r.Register(ctx, "hello", endpoint(i))
+			}
+			for i := 0; i < tt.deregister; i++ {
+				r.Deregister(ctx, "hello", endpoint(i))
+			}
+
+			current := make(map[string]*Endpoint)
+			want := 1 + tt.register + tt.deregister
+			timeout := time.After(5 * time.Second)
+			for n := 0; n < want; n++ {
+				select {
+				case ev := <-ch:
+					applyEvent(current, ev)
+				case <-timeout:
+					t.Fatalf("received %d events, want %d", n, want)
+				}
+			}
+			if len(current) != 1+tt.register-tt.deregister {
+				t.Fatalf("endpoints = %d, want %d", len(current), 1+tt.register-tt.deregister)
+			}
+			for i := tt.deregister; i < tt.register; i++ {
+				if _, ok := current[endpoint(i).IPPort()]; !ok {
+					t.Fatalf("endpoint %s missing", endpoint(i).IPPort())
+				}
+			}
+
+			cancel()
+			select {
+			case _, ok := <-ch:
+				if ok {
+					t.Fatal("unexpected event after cancel")
+				}
+			case <-time.After(time.Second):
+				t.Fatal("chan not closed after cancel")
+			}
+		})
+	}
+}
+
+func applyEvent(current map[string]*Endpoint, ev *ResolverEvent) {
+	switch ev.Type {
+	case ResolverEvent_Add:
+		current[ev.Endpoint.IPPort()] = ev.Endpoint
+	case ResolverEvent_Remove:
+		delete(current, ev.Endpoint.IPPort())
+	}
+}
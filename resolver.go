@@ -0,0 +1,213 @@
+package civet
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/YCloud/civet/tlog"
+	"gopkg.in/yaml.v3"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+type ResolverEventType uint8
+
+const (
+	// 新增节点，节点已存在时表示更新
+	ResolverEvent_Add ResolverEventType = 1 + iota
+	// 删除节点
+	ResolverEvent_Remove
+)
+
+func (t ResolverEventType) String() string {
+	switch t {
+	case ResolverEvent_Add:
+		return "add"
+	case ResolverEvent_Remove:
+		return "remove"
+	default:
+		return fmt.Sprintf("event(%d)", t)
+	}
+}
+
+type ResolverEvent struct {
+	Type     ResolverEventType
+	Endpoint *Endpoint
+}
+
+// Resolver 服务发现，Watch 返回的 chan 持续推送 service 的节点变化，ctx 取消后关闭 chan
+type Resolver interface {
+	Watch(ctx context.Context, service string) (<-chan *ResolverEvent, error)
+}
+
+// NewStaticResolver 固定节点列表
+func NewStaticResolver(endpoints ...*Endpoint) Resolver {
+	return &pollResolver{
+		lookup: func(string) ([]*Endpoint, error) {
+			return endpoints, nil
+		},
+	}
+}
+
+// NewFileResolver 从 yaml 或 json 文件中读取节点，按文件扩展名区分格式，每隔 interval 重新读取一次。
+// 文件内容为服务名到节点列表的映射：
+//
+//	hello:
+//	  - ip: 127.0.0.1
+//	    port: 10010
+//	    weight: 10
+func NewFileResolver(path string, interval time.Duration) Resolver {
+	return &pollResolver{
+		interval: interval,
+		lookup: func(service string) ([]*Endpoint, error) {
+			services, err := readEndpointFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return services[service], nil
+		},
+	}
+}
+
+// NewDNSResolver 通过 dns 解析节点，port 为空时查询 host 的 SRV 记录，否则查询 A/AAAA 记录并使用 port
+func NewDNSResolver(host string, port string, interval time.Duration) Resolver {
+	return &pollResolver{
+		interval: interval,
+		lookup: func(string) ([]*Endpoint, error) {
+			if port == "" {
+				return lookupSRV(host)
+			}
+			return lookupHost(host, port)
+		},
+	}
+}
+
+func lookupSRV(host string) ([]*Endpoint, error) {
+	_, addrs, err := net.LookupSRV("", "", host)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]*Endpoint, 0, len(addrs))
+	for _, addr := range addrs {
+		ips, err := net.LookupHost(addr.Target)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			endpoints = append(endpoints, &Endpoint{
+				IP:     ip,
+				Port:   strconv.Itoa(int(addr.Port)),
+				Weight: int32(addr.Weight),
+			})
+		}
+	}
+	return endpoints, nil
+}
+
+func lookupHost(host string, port string) ([]*Endpoint, error) {
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]*Endpoint, 0, len(ips))
+	for _, ip := range ips {
+		endpoints = append(endpoints, &Endpoint{IP: ip, Port: port})
+	}
+	return endpoints, nil
+}
+
+func readEndpointFile(path string) (map[string][]*Endpoint, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	services := make(map[string][]*Endpoint)
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(bs, &services)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(bs, &services)
+	default:
+		err = fmt.Errorf("unknown endpoint file format: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+// pollResolver 定时调用 lookup，将前后两次结果的差异推送出去；interval 为 0 时只查询一次
+type pollResolver struct {
+	interval time.Duration
+	lookup   func(service string) ([]*Endpoint, error)
+}
+
+func (r *pollResolver) Watch(ctx context.Context, service string) (<-chan *ResolverEvent, error) {
+	endpoints, err := r.lookup(service)
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*Endpoint)
+	events := diffEndpoints(current, endpoints)
+	// 首次结果在返回前放入 chan，调用方可以立即拿到
+	ch := make(chan *ResolverEvent, len(events)+64)
+	for _, ev := range events {
+		ch <- ev
+	}
+
+	go func() {
+		defer close(ch)
+		if r.interval <= 0 {
+			<-ctx.Done()
+			return
+		}
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				endpoints, err := r.lookup(service)
+				if err != nil {
+					tlog.Warn("resolver lookup error", tlog.Any("service", service), tlog.Any("err", err))
+					continue
+				}
+				for _, ev := range diffEndpoints(current, endpoints) {
+					select {
+					case ch <- ev:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// diffEndpoints 计算 current 到 endpoints 的变化，并将 current 更新为 endpoints
+func diffEndpoints(current map[string]*Endpoint, endpoints []*Endpoint) []*ResolverEvent {
+	events := make([]*ResolverEvent, 0)
+	latest := make(map[string]*Endpoint, len(endpoints))
+	for _, endpoint := range endpoints {
+		ipport := endpoint.IPPort()
+		latest[ipport] = endpoint
+		if old, ok := current[ipport]; !ok || old.Weight != endpoint.Weight {
+			events = append(events, &ResolverEvent{Type: ResolverEvent_Add, Endpoint: endpoint})
+		}
+	}
+	for ipport, endpoint := range current {
+		if _, ok := latest[ipport]; !ok {
+			events = append(events, &ResolverEvent{Type: ResolverEvent_Remove, Endpoint: endpoint})
+			delete(current, ipport)
+		}
+	}
+	for ipport, endpoint := range latest {
+		current[ipport] = endpoint
+	}
+	return events
+}
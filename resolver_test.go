@@ -0,0 +1,88 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/YCloud/civet/internal/config"
+)
+
+func newResolverTestClient(resolver Resolver) *Client {
+	client := &Client{
+		service:  "hello",
+		pools:    make(map[string]*clientConnPool),
+		breakers: make(map[string]*breaker),
+		cfg:      &config.ClientConf{MaxConnNum: 1},
+		balancer: NewRoundRobinBalancer(),
+		resolver: resolver,
+	}
+	client.ctx, client.cancel = context.WithCancel(context.Background())
+	return client
+}
+
+func (client *Client) endpointCount() int {
+	client.mux.Lock()
+	defer client.mux.Unlock()
+	return len(client.endpoints)
+}
+
+// flakyResolver 前 failures 次 Watch 返回错误
+type flakyResolver struct {
+	failures int32
+	calls    atomic.Int32
+	Resolver
+}
+
+func (r *flakyResolver) Watch(ctx context.Context, service string) (<-chan *ResolverEvent, error) {
+	if r.calls.Add(1) <= r.failures {
+		return nil, errors.New("lookup failed")
+	}
+	return r.Resolver.Watch(ctx, service)
+}
+
+func TestWatchResolverRetry(t *testing.T) {
+	endpoints := []*Endpoint{{IP: "127.0.0.1", Port: "10001"}, {IP: "127.0.0.1", Port: "10002"}}
+	tests := []struct {
+		name     string
+		failures int32
+	}{
+		{"first watch succeeds", 0},
+		{"first watch fails", 1},
+		{"several watches fail", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolver := &flakyResolver{failures: tt.failures, Resolver: NewStaticResolver(endpoints...)}
+			client := newResolverTestClient(resolver)
+			defer client.cancel()
+			client.watchResolver()
+			if tt.failures == 0 && client.endpointCount() != len(endpoints) {
+				t.Fatalf("endpoints = %d before NewClient returns, want %d", client.endpointCount(), len(endpoints))
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for client.endpointCount() != len(endpoints) {
+				if time.Now().After(deadline) {
+					t.Fatalf("endpoints = %d after %d watches, want %d", client.endpointCount(), resolver.calls.Load(), len(endpoints))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if got := resolver.calls.Load(); got != tt.failures+1 {
+				t.Fatalf("watch called %d times, want %d", got, tt.failures+1)
+			}
+		})
+	}
+}
+
+func TestWatchResolverStopsAfterClose(t *testing.T) {
+	resolver := &flakyResolver{failures: 1 << 30, Resolver: NewStaticResolver()}
+	client := newResolverTestClient(resolver)
+	client.watchResolver()
+	client.cancel()
+	time.Sleep(2 * resolverMinBackoff)
+	if got := resolver.calls.Load(); got != 1 {
+		t.Fatalf("watch called %d times after close, want 1", got)
+	}
+}
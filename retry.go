@@ -0,0 +1,204 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	errors2 "github.com/YCloud/civet/errors"
+	"github.com/YCloud/civet/internal/config"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 重试策略，只对幂等的方法生效
+type RetryPolicy struct {
+	// 最大尝试次数，包含第一次请求
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	// 退避时间的随机抖动比例，取值 0~1
+	Jitter float64
+	// 可重试的错误码，连接错误总是可以重试
+	RetryableCodes []int32
+}
+
+func newRetryPolicy(cfg *config.RetryConf) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		Multiplier:     cfg.Multiplier,
+		Jitter:         cfg.Jitter,
+		RetryableCodes: cfg.RetryableCodes,
+	}
+}
+
+// backoff 第 attempt 次重试前的等待时间，attempt 从 1 开始
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= p.Multiplier
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	return time.Duration(d)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, ErrBadConn) || errors.Is(err, ErrNoEndpoint) {
+		return true
+	}
+	var e *errors2.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	for _, code := range p.RetryableCodes {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	retryBudgetMin = 10
+	retryBudgetMax = 100
+)
+
+// retryBudget 限制重试占总请求的比例：每个请求存入 percent/100 个令牌，每次重试消耗一个令牌
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+func newRetryBudget(percent float64) *retryBudget {
+	return &retryBudget{
+		ratio:  percent / 100,
+		tokens: retryBudgetMin,
+	}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > retryBudgetMax {
+		b.tokens = retryBudgetMax
+	}
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// WithClientRetryPolicy 设置客户端默认的重试策略，覆盖配置中的 retry
+func WithClientRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(client *Client) {
+		client.retryPolicy = policy
+	}
+}
+
+// WithClientIdempotentMethods 标记幂等的方法，只有幂等的方法会重试
+func WithClientIdempotentMethods(methods ...string) ClientOption {
+	return func(client *Client) {
+		for _, method := range methods {
+			client.idempotent[method] = true
+		}
+	}
+}
+
+// WithClientCallOptionRetry 本次调用使用的重试策略
+func WithClientCallOptionRetry(policy *RetryPolicy) ClientCallOption {
+	return func(o *clientCallOptions) {
+		o.retryPolicy = policy
+	}
+}
+
+// WithClientCallOptionIdempotent 标记本次调用是幂等的
+func WithClientCallOptionIdempotent() ClientCallOption {
+	return func(o *clientCallOptions) {
+		o.idempotent = true
+	}
+}
+
+func (client *Client) getRetryPolicy(method string, callOptions *clientCallOptions) *RetryPolicy {
+	if !callOptions.idempotent && !client.idempotent[method] {
+		return nil
+	}
+	policy := callOptions.retryPolicy
+	if policy == nil {
+		policy = client.retryPolicy
+	}
+	if policy == nil || policy.MaxAttempts <= 1 {
+		return nil
+	}
+	return policy
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type triedKey struct{}
+
+// triedEndpoints 同一次调用的多次尝试已经使用过的节点，后续尝试尽量选择其他节点
+type triedEndpoints struct {
+	mu    sync.Mutex
+	addrs map[string]bool
+}
+
+func withTriedEndpoints(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(triedKey{}).(*triedEndpoints); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, triedKey{}, &triedEndpoints{addrs: make(map[string]bool)})
+}
+
+func triedFromContext(ctx context.Context) *triedEndpoints {
+	t, _ := ctx.Value(triedKey{}).(*triedEndpoints)
+	return t
+}
+
+func (t *triedEndpoints) exclude() map[string]bool {
+	exclude := make(map[string]bool)
+	if t == nil {
+		return exclude
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for addr := range t.addrs {
+		exclude[addr] = true
+	}
+	return exclude
+}
+
+func (t *triedEndpoints) add(addr string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.addrs[addr] = true
+}
@@ -0,0 +1,169 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	errors2 "github.com/YCloud/civet/errors"
+)
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		percent  float64
+		requests int
+		// 在 requests 个请求之后可以重试的次数
+		want int
+	}{
+		{"initial tokens", 25, 0, retryBudgetMin},
+		{"no percent", 0, 1000, retryBudgetMin},
+		{"quarter percent", 25, 100, retryBudgetMin + 25},
+		{"fifty percent", 50, 30, retryBudgetMin + 15},
+		{"full percent", 100, 50, retryBudgetMin + 50},
+		{"capped", 100, 1000, retryBudgetMax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newRetryBudget(tt.percent)
+			for i := 0; i < tt.requests; i++ {
+				b.deposit()
+			}
+			got := 0
+			for b.withdraw() {
+				got++
+			}
+			if got != tt.want {
+				t.Fatalf("withdrawn %d, want %d", got, tt.want)
+			}
+			// 令牌不足一个时不能重试，再次存入后恢复
+			for i := 0; i < 4; i++ {
+				b.deposit()
+			}
+			if tt.percent >= 25 && !b.withdraw() {
+				t.Fatal("withdraw after deposit rejected")
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+		Multiplier:     2,
+	}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.want {
+			t.Fatalf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("backoff with jitter = %v, want within [100ms, 300ms]", got)
+		}
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	policy := &RetryPolicy{RetryableCodes: []int32{503}}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad conn", ErrBadConn, true},
+		{"no endpoint", ErrNoEndpoint, true},
+		{"retryable code", errors2.NewError("hello", 503, "server overloaded"), true},
+		{"other code", errors2.NewError("hello", 500, "internal error"), false},
+		{"business error", errors2.NewError("hello", 1001, "user not found"), false},
+		{"other error", errors.New("oops"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.retryable(tt.err); got != tt.want {
+				t.Fatalf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetRetryPolicy(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3}
+	client := &Client{idempotent: map[string]bool{"Get": true}, retryPolicy: policy}
+	tests := []struct {
+		name        string
+		method      string
+		callOptions *clientCallOptions
+		want        *RetryPolicy
+	}{
+		{"idempotent method", "Get", &clientCallOptions{}, policy},
+		{"non idempotent method", "Create", &clientCallOptions{}, nil},
+		{"idempotent call", "Create", &clientCallOptions{idempotent: true}, policy},
+		{"call policy", "Get", &clientCallOptions{retryPolicy: &RetryPolicy{MaxAttempts: 1}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := client.getRetryPolicy(tt.method, tt.callOptions); got != tt.want {
+				t.Fatalf("policy = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCallRetryBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		percent float64
+		method  string
+		calls   int
+		// 所有调用的尝试次数与剩余令牌
+		wantAttempts int
+		wantTokens   float64
+	}{
+		{"within budget", 0, "Get", 5, 15, 0},
+		{"budget exhausted", 0, "Get", 8, 18, 0},
+		{"deposit per call", 100, "Get", 8, 24, 2},
+		{"non idempotent", 100, "Create", 8, 8, 18},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newResolverTestClient(nil)
+			defer client.cancel()
+			client.enc = GetEncoder("json")
+			client.idempotent = map[string]bool{"Get": true}
+			client.retryPolicy = &RetryPolicy{MaxAttempts: 3}
+			client.retryBudget = newRetryBudget(tt.percent)
+			attempts := 0
+			client.unaryInterceptor = func(ctx context.Context, ipport string, reqMsg *Request, enc Encoder, rsp any, invoker ClientInvoker) error {
+				attempts++
+				return ErrBadConn
+			}
+			for i := 0; i < tt.calls; i++ {
+				if err := client.Call(context.Background(), tt.method, "", &struct{}{}, &struct{}{}); err != ErrBadConn {
+					t.Fatalf("err = %v, want ErrBadConn", err)
+				}
+			}
+			if attempts != tt.wantAttempts {
+				t.Fatalf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if got := client.retryBudget.tokens; got != tt.wantTokens {
+				t.Fatalf("tokens = %v, want %v", got, tt.wantTokens)
+			}
+		})
+	}
+}
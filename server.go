@@ -3,7 +3,10 @@ package civet
 import (
 	"context"
 	"fmt"
+	"github.com/YCloud/civet/internal/config"
 	"github.com/YCloud/civet/tlog"
+	"github.com/YCloud/civet/trace"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,6 +15,12 @@ import (
 	"time"
 )
 
+const (
+	registryTimeout = 3 * time.Second
+	// 停止时等待 trace 导出剩余 span 的时间
+	traceShutdownTimeout = 3 * time.Second
+)
+
 type Dispatch func(ctx context.Context, impl any, enc Encoder, method string, in []byte) (out []byte, err error)
 
 type Server interface {
@@ -26,6 +35,12 @@ type application struct {
 	wg          sync.WaitGroup
 	startErr    error
 	stopChan    chan struct{}
+	stopOnce    sync.Once
+	registry    Registry
+	exporter    trace.SpanExporter
+	admin       Server
+	// 配置重新加载后依次调用
+	reloadHooks []func(cfg *config.Config)
 }
 
 var app *application
@@ -52,6 +67,14 @@ func addServant(server Server) {
 }
 
 func Run() error {
+	if err := initLog(config.GetConfig()); err != nil {
+		return err
+	}
+	applyLogConf(config.GetConfig())
+	if err := initTrace(); err != nil {
+		return err
+	}
+	initAdmin()
 
 	for _, srv := range app.servantList {
 		app.wg.Add(1)
@@ -67,9 +90,232 @@ func Run() error {
 		return app.startErr
 	}
 
+	if err := initRegistry(); err != nil {
+		stop()
+		return err
+	}
+	register()
+
 	return mainLoop()
 }
 
+func initRegistry() error {
+	if app.registry != nil {
+		return nil
+	}
+	cfg := config.GetConfig().Registry
+	if cfg == nil {
+		return nil
+	}
+	switch cfg.Type {
+	case "file":
+		app.registry = NewFileRegistry(cfg.Path)
+		return nil
+	default:
+		return fmt.Errorf("unknown registry type %s", cfg.Type)
+	}
+}
+
+// SetSpanExporter 设置 span 的导出，覆盖配置中的 trace，需在 Run 之前调用
+func SetSpanExporter(exporter trace.SpanExporter) {
+	app.exporter = exporter
+}
+
+// serviceName 本进程的服务名，app.server
+func serviceName(cfg *config.Config) string {
+	return cfg.App + "." + cfg.Server
+}
+
+func initTrace() error {
+	if app.exporter == nil {
+		exporter, err := newSpanExporter(config.GetConfig())
+		if err != nil {
+			return err
+		}
+		app.exporter = exporter
+	}
+	if app.exporter != nil {
+		trace.SetExporter(app.exporter)
+	}
+	return nil
+}
+
+func newSpanExporter(cfg *config.Config) (trace.SpanExporter, error) {
+	traceCfg := cfg.Trace
+	if traceCfg == nil {
+		return nil, nil
+	}
+	switch traceCfg.Exporter {
+	case "stdout":
+		return trace.NewStdoutExporter(), nil
+	case "file":
+		return trace.NewFileExporter(traceCfg.Path)
+	case "otlp":
+		return trace.NewOTLPHTTPExporter(traceCfg.Endpoint, serviceName(cfg), traceCfg.Headers), nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %s", traceCfg.Exporter)
+	}
+}
+
+// initLog 按配置创建日志输出，写入文件时按配置切分；日志都经过异步队列写入，不阻塞请求
+func initLog(cfg *config.Config) error {
+	logCfg := cfg.LogConf
+	if logCfg == nil {
+		return nil
+	}
+	enc, err := newLogEncoder(logCfg.Encoder)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stdout
+	if logCfg.LogName != "" {
+		interval, err := tlog.ParseRotateInterval(logCfg.Rotate)
+		if err != nil {
+			return err
+		}
+		w, err = tlog.NewRotateWriter(tlog.RotateConfig{
+			Dir:        logCfg.LogPath,
+			Name:       logCfg.LogName,
+			MaxSize:    int64(logCfg.MaxSize) << 20,
+			MaxBackups: logCfg.MaxBackups,
+			MaxAge:     logCfg.MaxAge,
+			Interval:   interval,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w = tlog.NewAsyncWriter(w, logCfg.QueueSize, tlog.ParseDropPolicy(logCfg.DropPolicy))
+	tlog.SetLogger(tlog.NewLogger(
+		tlog.WithEncoder(enc),
+		tlog.WithWriter(w),
+		tlog.WithFields(tlog.Any("pid", os.Getpid())),
+	))
+	return nil
+}
+
+// newLogEncoder text 或 json
+func newLogEncoder(name string) (tlog.Encoder, error) {
+	switch name {
+	case "text":
+		return tlog.NewTextEncoder(nil), nil
+	case "json":
+		return tlog.NewJSONEncoder(nil), nil
+	default:
+		return nil, fmt.Errorf("unknown log encoder %s", name)
+	}
+}
+
+// applyLogConf 应用可以在运行时修改的日志级别与 headers
+func applyLogConf(cfg *config.Config) {
+	if cfg.LogConf == nil {
+		return
+	}
+	tlog.SetContextHeaders(cfg.LogConf.Headers...)
+	if cfg.LogConf.Level == "" {
+		return
+	}
+	lv, err := tlog.ParseLevel(cfg.LogConf.Level)
+	if err != nil {
+		tlog.Error("invalid log level", tlog.Any("err", err))
+		return
+	}
+	tlog.SetLevel(lv)
+}
+
+// onReload 注册配置重新加载后的回调，需在 Run 之前调用
+func onReload(fn func(cfg *config.Config)) {
+	app.reloadHooks = append(app.reloadHooks, fn)
+}
+
+// reloadConfig 重新读取配置文件并应用可以在运行时修改的部分
+func reloadConfig() error {
+	cfg, err := config.Reload()
+	if err != nil {
+		return err
+	}
+	applyLogConf(cfg)
+	reloadRateLimits(cfg)
+	for _, fn := range app.reloadHooks {
+		fn(cfg)
+	}
+	tlog.Info("config reloaded")
+	return nil
+}
+
+func getServant(name string) Server {
+	for _, srv := range app.servantList {
+		if srv.Name() == name {
+			return srv
+		}
+	}
+	return nil
+}
+
+// drainServant 从 Registry 注销并停止 servant，进程中的其他 servant 继续运行
+func drainServant(name string) error {
+	srv := getServant(name)
+	if srv == nil || srv == app.admin {
+		return fmt.Errorf("servant %s not found", name)
+	}
+	if app.registry != nil {
+		endpoint := registerEndpoint(srv)
+		ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+		err := app.registry.Deregister(ctx, srv.Name(), endpoint)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	tlog.Info("drain servant", tlog.Any("servant", name), tlog.Any("endpoint", srv.Endpoint().IPPort()))
+	return srv.Stop()
+}
+
+func register() {
+	if app.registry == nil {
+		return
+	}
+	for _, srv := range app.servantList {
+		if srv == app.admin {
+			continue
+		}
+		endpoint := registerEndpoint(srv)
+		ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+		err := app.registry.Register(ctx, srv.Name(), endpoint)
+		cancel()
+		if err != nil {
+			tlog.Error("register servant error", tlog.Any("servant", srv.Name()), tlog.Any("endpoint", endpoint.IPPort()), tlog.Any("err", err))
+			continue
+		}
+		tlog.Info("register servant", tlog.Any("servant", srv.Name()), tlog.Any("endpoint", endpoint.IPPort()))
+	}
+}
+
+func deregister() {
+	if app.registry == nil {
+		return
+	}
+	for _, srv := range app.servantList {
+		if srv == app.admin {
+			continue
+		}
+		endpoint := registerEndpoint(srv)
+		ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+		err := app.registry.Deregister(ctx, srv.Name(), endpoint)
+		cancel()
+		if err != nil {
+			tlog.Error("deregister servant error", tlog.Any("servant", srv.Name()), tlog.Any("endpoint", endpoint.IPPort()), tlog.Any("err", err))
+		}
+	}
+}
+
+// Stop 停止 Run 启动的服务，Run 随之返回
+func Stop() {
+	app.stopOnce.Do(func() {
+		close(app.stopChan)
+	})
+}
+
 func mainLoop() error {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
@@ -93,18 +339,34 @@ func mainLoop() error {
 }
 
 func keepalive() {
-
+	for _, srv := range app.servantList {
+		if k, ok := srv.(interface{ keepalive() }); ok {
+			k.keepalive()
+		}
+	}
 }
 
 func stop() {
 	tlog.Info("stop service begin")
+	deregister()
+	wg := sync.WaitGroup{}
 	for _, srv := range app.servantList {
-		tlog.Info("stop servant", tlog.Any("servant", srv.Name()), tlog.Any("endpoint", srv.Endpoint().IPPort()))
-		err := srv.Stop()
-		if err != nil {
-			tlog.Error("stop servant error", tlog.Any("err", err))
-		}
+		wg.Add(1)
+		go func(srv Server) {
+			defer wg.Done()
+			tlog.Info("stop servant", tlog.Any("servant", srv.Name()), tlog.Any("endpoint", srv.Endpoint().IPPort()))
+			err := srv.Stop()
+			if err != nil {
+				tlog.Error("stop servant error", tlog.Any("err", err))
+			}
+		}(srv)
+	}
+	wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+	if err := trace.Shutdown(ctx); err != nil {
+		tlog.Error("shutdown trace exporter error", tlog.Any("err", err))
 	}
+	cancel()
 	tlog.Info("stop service end")
 	tlog.Flush()
 }
@@ -2,11 +2,13 @@ package civet
 
 import (
 	"context"
-	"fmt"
+	"github.com/YCloud/civet/errors"
 	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/meta"
 	"github.com/YCloud/civet/tlog"
 	"net"
 	"net/http"
+	"sync/atomic"
 )
 
 type HttpServerOption func(srv *httpServer)
@@ -23,29 +25,44 @@ type httpServer struct {
 	name             string
 	cfg              *config.ServantConf
 	endpoint         *Endpoint
+	handler          http.Handler
 	interceptors     []HttpInterceptor
 	unaryInterceptor HttpInterceptor
+	isShutdown       atomic.Bool
+	accessLog        *accessLogger
+	auth             *Auth
+	rateLimiter      *rateLimiter
 }
 
 func newHttpServer(name string, handler http.Handler, opts ...HttpServerOption) *httpServer {
-	cfg := config.GetServantConf(name)
+	return newHttpServerWithConf(name, config.GetServantConf(name), handler, opts...)
+}
+
+func newHttpServerWithConf(name string, cfg *config.ServantConf, handler http.Handler, opts ...HttpServerOption) *httpServer {
 	srv := &httpServer{
-		name: name,
-		cfg:  cfg,
+		name:    name,
+		cfg:     cfg,
+		handler: handler,
+		endpoint: &Endpoint{
+			IP:       cfg.IP,
+			Port:     cfg.Port,
+			Weight:   cfg.Weight,
+			Metadata: cfg.Metadata,
+		},
 	}
 
 	for _, opt := range opts {
 		opt(srv)
 	}
 
-	srv.Addr = fmt.Sprintf("%s:%s", cfg.IP, cfg.Port)
-	srv.Handler = handler
+	srv.Addr = net.JoinHostPort(cfg.IP, cfg.Port)
+	// 请求经过 ServeHTTP 中的拦截器后再交给 handler
+	srv.Handler = srv
 	return srv
 }
 
 func (srv *httpServer) Start() error {
-	srv.unaryInterceptor = buildHttpInterceptor(srv.interceptors...)
-	lis, err := net.Listen("tcp", srv.Addr)
+	lis, err := srv.init()
 	if err != nil {
 		app.wg.Done()
 		app.startErr = err
@@ -56,8 +73,52 @@ func (srv *httpServer) Start() error {
 	return srv.Serve(lis)
 }
 
+// init 创建拦截器、listener 与访问日志
+func (srv *httpServer) init() (net.Listener, error) {
+	if srv.auth == nil && srv.cfg.Auth != nil {
+		auth, err := newAuthFromConf(srv.cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		srv.auth = auth
+	}
+	limiter, err := newRateLimiter(srv.name, srv.cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	srv.rateLimiter = limiter
+	// 按 principal 限流需要在认证之后
+	interceptors := append([]HttpInterceptor{srv.rateLimiter.httpInterceptor}, srv.interceptors...)
+	if srv.auth != nil {
+		interceptors = append([]HttpInterceptor{srv.auth.httpInterceptor}, interceptors...)
+	}
+	srv.unaryInterceptor = buildHttpInterceptor(srv.name, srv.handler, interceptors...)
+
+	lis, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return nil, err
+	}
+	tlsLis, err := newTLSListener(lis, srv.cfg.TLS)
+	if err != nil {
+		lis.Close()
+		return nil, err
+	}
+	lis = tlsLis
+	if srv.accessLog, err = newAccessLogger(srv.name, srv.cfg.AccessLog); err != nil {
+		lis.Close()
+		return nil, err
+	}
+	return lis, nil
+}
+
 func (srv *httpServer) Stop() error {
-	return srv.Shutdown(context.TODO())
+	if srv.isShutdown.Swap(true) {
+		return nil
+	}
+	defer srv.accessLog.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), srv.cfg.ShutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(ctx)
 }
 
 func (srv *httpServer) Name() string {
@@ -69,5 +130,25 @@ func (srv *httpServer) Endpoint() *Endpoint {
 }
 
 func (srv *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	srv.unaryInterceptor(w, r, srv.Handler.ServeHTTP)
+	ctx := meta.NewRouteContext(r.Context(), r.URL.Path)
+	ctx = newPeerContext(ctx, &Peer{Addr: r.RemoteAddr, TLS: r.TLS})
+	if srv.accessLog != nil {
+		rec := newAccessRecord(r.RemoteAddr, r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get(meta.Traceparent))
+		rec.reqSize = r.ContentLength
+		rw := wrapResponseWriter(w)
+		w = rw
+		ctx = withAccessRecord(ctx, rec)
+		defer func() {
+			status := rw.Status()
+			rec.respSize = rw.Size()
+			rec.code, rec.codeDesc = int32(status), http.StatusText(status)
+			srv.accessLog.log(rec)
+		}()
+	}
+	if !srv.rateLimiter.allow(r.URL.Path, r.Header) {
+		e := errors.ParseError(errors.ErrRateLimited)
+		http.Error(w, e.Desc, int(e.Code))
+		return
+	}
+	srv.unaryInterceptor(w, r.WithContext(ctx), srv.handler.ServeHTTP)
 }
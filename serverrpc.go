@@ -2,6 +2,7 @@ package civet
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	errors2 "errors"
 	"fmt"
@@ -12,9 +13,11 @@ import (
 	"io"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type ReadStat uint8
@@ -33,18 +36,29 @@ func WithServerInterceptors(interceptors ...ServerInterceptor) ServerOption {
 	}
 }
 
+func WithServerStreamDispatch(dispatch StreamDispatch) ServerOption {
+	return func(srv *rpcServer) {
+		srv.streamDispatch = dispatch
+	}
+}
+
 type rpcServer struct {
-	name     string
-	impl     any
-	dispatch Dispatch
-	cfg      *config.ServantConf
-	endpoint *Endpoint
+	name           string
+	impl           any
+	dispatch       Dispatch
+	streamDispatch StreamDispatch
+	cfg            *config.ServantConf
+	endpoint       *Endpoint
 
 	interceptors     []ServerInterceptor
 	unaryInterceptor ServerInterceptor
 
-	reqQueue chan struct{}
-	reqNum   atomic.Int32
+	concurrency *concurrencyLimiter
+	reqNum      atomic.Int32
+	streamNum   atomic.Int32
+	accessLog   *accessLogger
+	auth        *Auth
+	rateLimiter *rateLimiter
 
 	mu         sync.Mutex
 	isShutdown atomic.Bool
@@ -62,21 +76,22 @@ func newRpcServer(name string, impl any, dispatch Dispatch, opts ...ServerOption
 		conns:    make(map[*serverConn]struct{}),
 	}
 	srv.endpoint = &Endpoint{
-		IP:   cfg.IP,
-		Port: cfg.Port,
+		IP:       cfg.IP,
+		Port:     cfg.Port,
+		Weight:   cfg.Weight,
+		Metadata: cfg.Metadata,
 	}
 
 	for _, opt := range opts {
 		opt(srv)
 	}
 
-	srv.reqQueue = make(chan struct{}, srv.cfg.MaxRequestNum)
+	srv.concurrency = newConcurrencyLimiter(srv.name, srv.cfg.MaxRequestNum, srv.cfg.Concurrency)
 	return srv
 }
 
 func (srv *rpcServer) Start() error {
-	srv.unaryInterceptor = buildServerInterceptor(srv.interceptors...)
-	listen, err := net.Listen("tcp", fmt.Sprintf(":%s", srv.cfg.Port))
+	listen, err := srv.init()
 	if err != nil {
 		app.wg.Done()
 		app.startErr = err
@@ -91,11 +106,87 @@ func (srv *rpcServer) Start() error {
 	return srv.accept()
 }
 
+// init 创建拦截器、listener 与访问日志
+func (srv *rpcServer) init() (net.Listener, error) {
+	if srv.auth == nil && srv.cfg.Auth != nil {
+		auth, err := newAuthFromConf(srv.cfg.Auth)
+		if err != nil {
+			return nil, err
+		}
+		srv.auth = auth
+	}
+	limiter, err := newRateLimiter(srv.name, srv.cfg.RateLimit)
+	if err != nil {
+		return nil, err
+	}
+	srv.rateLimiter = limiter
+	// 按 principal 限流与判断 critical 优先级需要在认证之后
+	interceptors := append([]ServerInterceptor{srv.rateLimiter.serverInterceptor, srv.concurrency.serverInterceptor}, srv.interceptors...)
+	if srv.auth != nil {
+		interceptors = append([]ServerInterceptor{srv.auth.serverInterceptor}, interceptors...)
+	}
+	srv.unaryInterceptor = buildServerInterceptor(srv.name, interceptors...)
+
+	listen, err := net.Listen("tcp", fmt.Sprintf(":%s", srv.cfg.Port))
+	if err != nil {
+		return nil, err
+	}
+	tlsLis, err := newTLSListener(listen, srv.cfg.TLS)
+	if err != nil {
+		listen.Close()
+		return nil, err
+	}
+	listen = tlsLis
+	if srv.accessLog, err = newAccessLogger(srv.name, srv.cfg.AccessLog); err != nil {
+		listen.Close()
+		return nil, err
+	}
+	return listen, nil
+}
+
+// Stop 停止接收新连接，通知客户端不再发送新请求，等待进行中的请求和流结束或超过 ShutdownTimeout 后关闭连接
 func (srv *rpcServer) Stop() error {
-	srv.isShutdown.Store(true)
+	if srv.isShutdown.Swap(true) {
+		return nil
+	}
+	defer srv.accessLog.Close()
+	if srv.listen != nil {
+		srv.listen.Close()
+	}
+	conns := srv.getConns()
+	for _, sc := range conns {
+		sc.sendResponse(&Response{Flag: MessageFlag_GoAway})
+	}
+
+	deadline := time.Now().Add(srv.cfg.ShutdownTimeout)
+	for srv.reqNum.Load() > 0 || srv.streamNum.Load() > 0 {
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	reqNum, streamNum := srv.reqNum.Load(), srv.streamNum.Load()
+
+	// 写完已经排队的响应后再关闭连接
+	for _, sc := range conns {
+		sc.closeAfterSend(time.Until(deadline))
+	}
+	if reqNum > 0 || streamNum > 0 {
+		return fmt.Errorf("stop servant %s timeout, %d requests and %d streams abandoned", srv.name, reqNum, streamNum)
+	}
 	return nil
 }
 
+func (srv *rpcServer) getConns() []*serverConn {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	conns := make([]*serverConn, 0, len(srv.conns))
+	for sc := range srv.conns {
+		conns = append(conns, sc)
+	}
+	return conns
+}
+
 func (srv *rpcServer) Name() string {
 	return srv.name
 }
@@ -104,30 +195,64 @@ func (srv *rpcServer) Endpoint() *Endpoint {
 	return srv.endpoint
 }
 
+func (srv *rpcServer) invoke(ctx context.Context, enc Encoder, method string, in []byte) ([]byte, error) {
+	if srv.unaryInterceptor != nil {
+		return srv.unaryInterceptor(ctx, srv.impl, enc, method, in, srv.dispatch)
+	}
+	return srv.dispatch(ctx, srv.impl, enc, method, in)
+}
+
 func (srv *rpcServer) accept() error {
-	defer srv.close()
 	for {
 		conn, err := srv.listen.Accept()
 		if err != nil {
+			if srv.isShutdown.Load() {
+				return nil
+			}
+			srv.listen.Close()
 			return err
 		}
-		sc := srv.newServerConn(conn)
-		go sc.send()
-		go sc.recv()
+		go func() {
+			// TLS 握手完成后才能取得对端证书
+			if err := handshake(conn); err != nil {
+				tlog.Warn("tls handshake error", tlog.Any("servant", srv.name), tlog.Any("addr", conn.RemoteAddr().String()), tlog.Any("err", err))
+				conn.Close()
+				return
+			}
+			sc := srv.newServerConn(conn)
+			go sc.send()
+			sc.recv()
+		}()
 	}
 }
 
-func (srv *rpcServer) close() {
-	srv.listen.Close()
+// keepalive 关闭空闲超过 IdleTimeout 的连接，有处理中的请求或流的连接不算空闲
+func (srv *rpcServer) keepalive() {
+	if srv.cfg.IdleTimeout <= 0 {
+		return
+	}
+	now := time.Now()
+	idle := make([]*serverConn, 0)
 	srv.mu.Lock()
 	for sc := range srv.conns {
-		delete(srv.conns, sc)
+		if !sc.busy() && now.Sub(time.Unix(0, sc.lastActive.Load())) > srv.cfg.IdleTimeout {
+			idle = append(idle, sc)
+		}
 	}
 	srv.mu.Unlock()
+	for _, sc := range idle {
+		tlog.Info("close idle connection", tlog.Any("servant", srv.name), tlog.Any("addr", sc.conn.RemoteAddr().String()))
+		sc.close()
+	}
 }
 
 func (srv *rpcServer) newServerConn(conn net.Conn) *serverConn {
-	if tcpConn, ok := conn.(*net.TCPConn); ok {
+	peer := newPeer(conn)
+	rawConn := conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		rawConn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := rawConn.(*net.TCPConn); ok {
 		if srv.cfg.ReadBufSize > 0 {
 			tcpConn.SetReadBuffer(int(srv.cfg.ReadBufSize))
 		}
@@ -141,10 +266,15 @@ func (srv *rpcServer) newServerConn(conn net.Conn) *serverConn {
 	}
 	sc := &serverConn{
 		srv:       srv,
-		conn:      conn,
+		peer:      peer,
+		conn:      newCountingConn(conn, serverBytesReceived.With(srv.name), serverBytesSent.With(srv.name)),
 		closeChan: make(chan struct{}),
 		sendChan:  make(chan *Message, sendChanCap),
+		streams:   make(map[int32]*stream),
+		reqs:      make(map[int32]context.CancelFunc),
+		handlers:  make(chan struct{}, srv.cfg.MaxConnRequestNum),
 	}
+	sc.lastActive.Store(time.Now().UnixNano())
 	srv.mu.Lock()
 	srv.conns[sc] = struct{}{}
 	srv.mu.Unlock()
@@ -154,9 +284,22 @@ func (srv *rpcServer) newServerConn(conn net.Conn) *serverConn {
 type serverConn struct {
 	conn      net.Conn
 	srv       *rpcServer
+	peer      *Peer
 	isClose   atomic.Bool
 	sendChan  chan *Message
 	closeChan chan struct{}
+	// 最后一次收发数据的时间，UnixNano
+	lastActive atomic.Int64
+
+	streamMu sync.Mutex
+	streams  map[int32]*stream
+
+	// 处理中的请求，收到 Cancel 时取消
+	reqMu sync.Mutex
+	reqs  map[int32]context.CancelFunc
+
+	// 处理请求与推送的协程占用的槽位，容量为 MaxConnRequestNum
+	handlers chan struct{}
 }
 
 func (sc *serverConn) close() {
@@ -171,6 +314,14 @@ func (sc *serverConn) close() {
 
 	sc.conn.Close()
 	close(sc.closeChan)
+
+	sc.streamMu.Lock()
+	for id, st := range sc.streams {
+		st.finish(ErrBadConn)
+		st.cancel()
+		delete(sc.streams, id)
+	}
+	sc.streamMu.Unlock()
 }
 
 func (sc *serverConn) recv() {
@@ -187,6 +338,7 @@ func (sc *serverConn) recv() {
 			log.Printf("读取数据错误，err:%v\n", err)
 			return
 		}
+		sc.lastActive.Store(time.Now().UnixNano())
 		currentBuf = append(currentBuf, readBuf[:n]...)
 		for {
 			body, n, stat := sc.readBody(currentBuf)
@@ -221,62 +373,260 @@ func (sc *serverConn) handle(pkg []byte) {
 	}
 	switch req.Flag {
 	case MessageFlag_Req:
-		sc.invokeRequest(req)
+		if !sc.acquireHandler() {
+			return
+		}
+		// 在读协程中登记，保证随后到达的 Cancel 能找到请求
+		ctx, cancel := withRequestTimeout(context.Background(), req.Header, sc.srv.cfg.ReqTimeout)
+		sc.addReq(req.StreamId, cancel)
+		go sc.invokeRequest(ctx, cancel, req)
+	case MessageFlag_Push:
+		if !sc.acquireHandler() {
+			return
+		}
+		go sc.invokePush(req)
 	case MessageFlag_Ping:
+		sc.sendResponse(&Response{StreamId: req.StreamId, Flag: MessageFlag_PingResp})
+	case MessageFlag_StreamOpen:
+		sc.openStream(req)
+	case MessageFlag_StreamData:
+		if st := sc.getStream(req.StreamId); st != nil && !st.push(req.Body) {
+			st.finish(ErrStreamWindow)
+			st.cancel()
+		}
+	case MessageFlag_StreamClose:
+		if st := sc.getStream(req.StreamId); st != nil {
+			st.closeRecv(io.EOF)
+		}
+	case MessageFlag_StreamWindow:
+		if st := sc.getStream(req.StreamId); st != nil {
+			st.addCredit(parseWindow(req.Body))
+		}
+	case MessageFlag_Cancel:
+		if cancel, ok := sc.removeReq(req.StreamId); ok {
+			cancel()
+		} else if st := sc.getStream(req.StreamId); st != nil {
+			st.finish(ErrStreamClosed)
+			st.cancel()
+		}
+	}
+}
+
+// acquireHandler 连接上处理中的请求达到上限时阻塞读协程，由 TCP 流控反压客户端；连接关闭时返回 false
+func (sc *serverConn) acquireHandler() bool {
+	select {
+	case sc.handlers <- struct{}{}:
+		return true
+	case <-sc.closeChan:
+		return false
+	}
+}
+
+func (sc *serverConn) releaseHandler() {
+	<-sc.handlers
+}
+
+// busy 连接上是否有处理中的请求、推送或流
+func (sc *serverConn) busy() bool {
+	if len(sc.handlers) > 0 {
+		return true
+	}
+	sc.streamMu.Lock()
+	defer sc.streamMu.Unlock()
+	return len(sc.streams) > 0
+}
+
+func (sc *serverConn) openStream(req *Request) {
+	closeResp := &Response{StreamId: req.StreamId, Flag: MessageFlag_StreamClose}
+	dispatch := sc.srv.streamDispatch
+	if dispatch == nil {
+		closeResp.Code = 501
+		closeResp.CodeDesc = "stream not supported"
+		sc.sendResponse(closeResp)
+		return
+	}
+	enc := GetEncoder(req.Header[meta.ContentType])
+	if enc == nil {
+		closeResp.Code = 402
+		closeResp.CodeDesc = "content type error"
+		sc.sendResponse(closeResp)
+		return
+	}
+	if !sc.srv.rateLimiter.allow(req.Route, mapHeader(req.Header)) {
+		e := errors.ParseError(errors.ErrRateLimited)
+		closeResp.Code = e.Code
+		closeResp.CodeDesc = e.Desc
+		sc.sendResponse(closeResp)
+		return
+	}
+
+	i := strings.LastIndex(req.Route, "/")
+	method := req.Route[i+1:]
+	window := sc.srv.cfg.StreamWindow
+	start := time.Now()
+	// 流不受 ReqTimeout 限制，只继承客户端的超时
+	ctx, cancel := withRequestTimeout(context.Background(), req.Header, 0)
+	ctx = meta.NewMetaContextWithReqContext(ctx, req.Header)
+	ctx = meta.NewRouteContext(ctx, req.Route)
+	ctx = newPeerContext(ctx, sc.peer)
+	ctx = newPusherContext(ctx, sc, enc)
+	ctx, span := startServerSpan(ctx, method)
+	// reject 流建立失败时结束 span、记录指标并返回错误
+	reject := func(err error) {
+		cancel()
+		span.End(err)
+		observeServerRequest(sc.srv.name, method, start, err)
+		e := errors.ParseError(err)
+		closeResp.Code = e.Code
+		closeResp.CodeDesc = e.Desc
+		sc.sendResponse(closeResp)
+	}
+	if sc.srv.auth != nil {
+		var err error
+		// 流不经过拦截器，在建立时认证
+		if ctx, err = sc.srv.auth.authenticate(ctx, &AuthRequest{Route: req.Route, Header: mapHeader(req.Header), Peer: sc.peer}); err != nil {
+			reject(err)
+			return
+		}
+	}
+	if !sc.srv.rateLimiter.allowPrincipal(ctx, req.Route) {
+		reject(errors.ErrRateLimited)
+		return
+	}
+	// 流在关闭前一直占用并发，超过限制时立即返回 503
+	if !sc.srv.concurrency.acquireContext(ctx) {
+		reject(errors.ErrServerOverloaded)
+		return
+	}
+	st := newStream(ctx, cancel, req.StreamId, enc, window, func(flag MessageFlag, body []byte) error {
+		return sc.sendResponse(&Response{StreamId: req.StreamId, Flag: flag, Body: body})
+	})
+	peerWindow, _ := strconv.Atoi(req.Header[meta.StreamWindow])
+	st.addCredit(int32(peerWindow))
+
+	sc.streamMu.Lock()
+	sc.streams[req.StreamId] = st
+	sc.streamMu.Unlock()
+
+	st.write(MessageFlag_StreamWindow, windowBody(window))
+
+	sc.srv.streamNum.Add(1)
+	go func() {
+		defer func() {
+			sc.srv.concurrency.releaseStream()
+			sc.srv.streamNum.Add(-1)
+			sc.streamMu.Lock()
+			delete(sc.streams, req.StreamId)
+			sc.streamMu.Unlock()
+			cancel()
+		}()
+		err := dispatch(ctx, sc.srv.impl, method, st)
+		st.finish(ErrStreamClosed)
+		span.End(err)
+		observeServerRequest(sc.srv.name, method, start, err)
+		if err != nil {
+			e := errors.ParseError(err)
+			closeResp.Code = e.Code
+			closeResp.CodeDesc = e.Desc
+		}
+		sc.sendResponse(closeResp)
+	}()
+}
+
+func (sc *serverConn) getStream(id int32) *stream {
+	sc.streamMu.Lock()
+	defer sc.streamMu.Unlock()
+	return sc.streams[id]
+}
+
+func (sc *serverConn) addReq(id int32, cancel context.CancelFunc) {
+	sc.reqMu.Lock()
+	defer sc.reqMu.Unlock()
+	sc.reqs[id] = cancel
+}
 
+// removeReq 请求已被 Cancel 移除时返回 false
+func (sc *serverConn) removeReq(id int32) (context.CancelFunc, bool) {
+	sc.reqMu.Lock()
+	defer sc.reqMu.Unlock()
+	cancel, ok := sc.reqs[id]
+	delete(sc.reqs, id)
+	return cancel, ok
+}
+
+// reply 客户端已取消的请求不再返回响应，连接关闭后丢弃响应
+func (sc *serverConn) reply(msg *Message) {
+	if _, ok := sc.removeReq(msg.Req.StreamId); !ok {
+		return
+	}
+	select {
+	case <-sc.closeChan:
+	case sc.sendChan <- msg:
 	}
 }
 
-func (sc *serverConn) invokeRequest(req *Request) {
+func (sc *serverConn) invokeRequest(ctx context.Context, cancel context.CancelFunc, req *Request) {
 	sc.srv.reqNum.Add(1)
 	defer sc.srv.reqNum.Add(-1)
+	defer cancel()
+	// 槽位在处理协程启动后由其释放，超时返回时处理协程仍占用槽位
+	dispatched := false
+	defer func() {
+		if !dispatched {
+			sc.releaseHandler()
+		}
+	}()
 
 	msg := &Message{
-		Ctx:  context.TODO(),
-		Req:  req,
-		Resp: &Response{StreamId: req.StreamId, Flag: MessageFlag_Resp},
+		Ctx:    ctx,
+		Cancel: cancel,
+		Req:    req,
+		Resp:   &Response{StreamId: req.StreamId, Flag: MessageFlag_Resp},
 	}
 	i := strings.LastIndex(req.Route, "/")
 	method := req.Route[i+1:]
 	contentType := req.Header[meta.ContentType]
+	if sc.srv.accessLog != nil {
+		rec := newAccessRecord(sc.conn.RemoteAddr().String(), req.Route, contentType, req.Header[meta.Traceparent])
+		rec.reqSize = int64(len(req.Body))
+		msg.Ctx = withAccessRecord(msg.Ctx, rec)
+		defer func() {
+			rec.respSize = int64(len(msg.Resp.Body))
+			rec.code, rec.codeDesc = msg.Resp.Code, msg.Resp.CodeDesc
+			sc.srv.accessLog.log(rec)
+		}()
+	}
+	// 在占用请求队列之前限流
+	if !sc.srv.rateLimiter.allow(req.Route, mapHeader(req.Header)) {
+		e := errors.ParseError(errors.ErrRateLimited)
+		msg.Resp.Code = e.Code
+		msg.Resp.CodeDesc = e.Desc
+		sc.reply(msg)
+		return
+	}
 	msg.Encode = GetEncoder(contentType)
 	if msg.Encode == nil {
 		msg.Resp.Code = 402
 		msg.Resp.CodeDesc = "content type error"
-		sc.sendChan <- msg
+		sc.reply(msg)
 		return
 	}
 
-	cfg := sc.srv.cfg
-	if cfg.ReqTimeout > 0 {
-		msg.Ctx, msg.Cancel = context.WithTimeout(msg.Ctx, cfg.ReqTimeout)
-	} else {
-		msg.Ctx, msg.Cancel = context.WithCancel(msg.Ctx)
-	}
 	msg.Ctx = meta.NewMetaContextWithReqContext(msg.Ctx, msg.Req.Header)
+	msg.Ctx = meta.NewRouteContext(msg.Ctx, msg.Req.Route)
+	msg.Ctx = newPeerContext(msg.Ctx, sc.peer)
+	msg.Ctx = newPusherContext(msg.Ctx, sc, msg.Encode)
 
-	select {
-	case <-msg.Ctx.Done():
+	if msg.Ctx.Err() != nil {
 		msg.Resp.Code = 504
 		msg.Resp.CodeDesc = "request timeout"
-		sc.sendChan <- msg
+		sc.reply(msg)
 		return
-	case sc.srv.reqQueue <- struct{}{}:
-		defer func() {
-			<-sc.srv.reqQueue
-		}()
 	}
+	dispatched = true
 	go func() {
-		var (
-			out []byte
-			err error
-		)
-		intercept := sc.srv.unaryInterceptor
-		if intercept != nil {
-			out, err = intercept(msg.Ctx, sc.srv.impl, msg.Encode, method, msg.Req.Body, sc.srv.dispatch)
-		} else {
-			out, err = sc.srv.dispatch(msg.Ctx, sc.srv.impl, msg.Encode, method, msg.Req.Body)
-		}
+		defer sc.releaseHandler()
+		out, err := sc.srv.invoke(msg.Ctx, msg.Encode, method, msg.Req.Body)
 		if err != nil {
 			e := errors.ParseError(err)
 			msg.Resp.Code = e.Code
@@ -294,7 +644,65 @@ func (sc *serverConn) invokeRequest(req *Request) {
 			msg.Resp.Code = 504
 			msg.Resp.CodeDesc = "request timeout"
 		}
-		sc.sendChan <- msg
+		sc.reply(msg)
+	}
+}
+
+// invokePush 处理客户端推送的消息，不返回响应
+func (sc *serverConn) invokePush(req *Request) {
+	sc.srv.reqNum.Add(1)
+	defer sc.srv.reqNum.Add(-1)
+	defer sc.releaseHandler()
+
+	i := strings.LastIndex(req.Route, "/")
+	method := req.Route[i+1:]
+	enc := GetEncoder(req.Header[meta.ContentType])
+	if enc == nil {
+		tlog.Warn("push content type error", tlog.Any("route", req.Route))
+		return
+	}
+	if !sc.srv.rateLimiter.allow(req.Route, mapHeader(req.Header)) {
+		tlog.Warn("push rate limited", tlog.Any("route", req.Route))
+		return
+	}
+
+	ctx, cancel := withRequestTimeout(context.Background(), req.Header, sc.srv.cfg.ReqTimeout)
+	defer cancel()
+	ctx = meta.NewMetaContextWithReqContext(ctx, req.Header)
+	ctx = meta.NewRouteContext(ctx, req.Route)
+	ctx = newPeerContext(ctx, sc.peer)
+	ctx = newPusherContext(ctx, sc, enc)
+
+	if _, err := sc.srv.invoke(ctx, enc, method, req.Body); err != nil {
+		tlog.Warn("push dispatch error", tlog.Any("route", req.Route), tlog.Any("err", err))
+	}
+}
+
+func (sc *serverConn) sendResponse(resp *Response) error {
+	select {
+	case <-sc.closeChan:
+		return ErrBadConn
+	case sc.sendChan <- &Message{Resp: resp}:
+		return nil
+	}
+}
+
+// closeAfterSend 发送队列中的响应写完后关闭连接，超过 timeout 直接关闭
+func (sc *serverConn) closeAfterSend(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case sc.sendChan <- nil:
+	case <-sc.closeChan:
+		return
+	case <-timer.C:
+		sc.close()
+		return
+	}
+	select {
+	case <-sc.closeChan:
+	case <-timer.C:
+		sc.close()
 	}
 }
 
@@ -304,11 +712,16 @@ func (sc *serverConn) send() {
 		case <-sc.closeChan:
 			return
 		case msg := <-sc.sendChan:
+			if msg == nil {
+				sc.close()
+				return
+			}
 			body, err := MarshalResponse(msg.Resp)
 			if err != nil {
 				log.Printf("send body failed err:%v\n", err)
 			} else {
 				sc.conn.Write(body)
+				sc.lastActive.Store(time.Now().UnixNano())
 			}
 		}
 	}
@@ -0,0 +1,224 @@
+package civet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrStreamClosed = errors.New("stream closed")
+var ErrStreamWindow = errors.New("stream window exceeded")
+
+// StreamDispatch 流式请求的分发函数，返回时服务端关闭流，返回的错误通过 StreamClose 帧的 code 带给客户端
+type StreamDispatch func(ctx context.Context, impl any, method string, stream ServerStream) error
+
+type ServerStream interface {
+	Context() context.Context
+	SendMsg(m any) error
+	// RecvMsg 客户端半关闭后返回 io.EOF
+	RecvMsg(m any) error
+}
+
+type ClientStream interface {
+	Context() context.Context
+	SendMsg(m any) error
+	// RecvMsg 服务端结束流后返回 io.EOF 或服务端返回的错误
+	RecvMsg(m any) error
+	// CloseSend 半关闭，之后不能再调用 SendMsg
+	CloseSend() error
+}
+
+type streamWriter func(flag MessageFlag, body []byte) error
+
+// stream 客户端与服务端共用的流实现，流控以消息个数为单位：
+// 接收方通告窗口大小，发送方每发一条数据消耗一个额度，接收方每消费半个窗口回送一次 StreamWindow
+type stream struct {
+	id     int32
+	ctx    context.Context
+	cancel context.CancelFunc
+	enc    Encoder
+	window int32
+	write  streamWriter
+
+	mu       sync.Mutex
+	credit   int32
+	creditCh chan struct{}
+
+	recvMu     sync.Mutex
+	recvCh     chan []byte
+	recvClosed bool
+	recvErr    error
+	consumed   atomic.Int32
+
+	sendClosed atomic.Bool
+	done       chan struct{}
+	doneOnce   sync.Once
+}
+
+func newStream(ctx context.Context, cancel context.CancelFunc, id int32, enc Encoder, window int32, write streamWriter) *stream {
+	return &stream{
+		id:       id,
+		ctx:      ctx,
+		cancel:   cancel,
+		enc:      enc,
+		window:   window,
+		write:    write,
+		creditCh: make(chan struct{}, 1),
+		recvCh:   make(chan []byte, window),
+		done:     make(chan struct{}),
+	}
+}
+
+func (s *stream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *stream) SendMsg(m any) error {
+	if s.sendClosed.Load() || s.isDone() {
+		return ErrStreamClosed
+	}
+	body, err := s.enc.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err = s.acquireCredit(); err != nil {
+		return err
+	}
+	return s.write(MessageFlag_StreamData, body)
+}
+
+func (s *stream) RecvMsg(m any) error {
+	var (
+		body []byte
+		ok   bool
+	)
+	select {
+	case body, ok = <-s.recvCh:
+		if !ok {
+			return s.recvErr
+		}
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+	threshold := s.window / 2
+	if threshold <= 0 {
+		threshold = 1
+	}
+	if s.consumed.Add(1) >= threshold {
+		if n := s.consumed.Swap(0); n > 0 {
+			s.write(MessageFlag_StreamWindow, windowBody(n))
+		}
+	}
+	return s.enc.Unmarshal(body, m)
+}
+
+func (s *stream) CloseSend() error {
+	if s.sendClosed.Swap(true) {
+		return nil
+	}
+	return s.write(MessageFlag_StreamClose, nil)
+}
+
+func (s *stream) acquireCredit() error {
+	for {
+		s.mu.Lock()
+		if s.credit > 0 {
+			s.credit--
+			s.mu.Unlock()
+			return nil
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.creditCh:
+		case <-s.done:
+			return ErrStreamClosed
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
+	}
+}
+
+func (s *stream) addCredit(n int32) {
+	if n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	s.credit += n
+	s.mu.Unlock()
+	select {
+	case s.creditCh <- struct{}{}:
+	default:
+	}
+}
+
+// push 由连接的接收协程调用，超出窗口返回 false
+func (s *stream) push(body []byte) bool {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if s.recvClosed {
+		return true
+	}
+	select {
+	case s.recvCh <- body:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *stream) closeRecv(err error) {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if s.recvClosed {
+		return
+	}
+	s.recvClosed = true
+	s.recvErr = err
+	close(s.recvCh)
+}
+
+// finish 流结束，不能再发送数据
+func (s *stream) finish(err error) {
+	s.closeRecv(err)
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (s *stream) isDone() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// err 流结束的原因，正常关闭时返回 nil，流被取消时返回 ctx 的错误
+func (s *stream) err() error {
+	s.recvMu.Lock()
+	defer s.recvMu.Unlock()
+	if !s.recvClosed {
+		return s.ctx.Err()
+	}
+	if s.recvErr == io.EOF || s.recvErr == ErrStreamClosed {
+		return nil
+	}
+	return s.recvErr
+}
+
+func windowBody(n int32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(n))
+	return b
+}
+
+func parseWindow(body []byte) int32 {
+	if len(body) < 4 {
+		return 0
+	}
+	return int32(binary.LittleEndian.Uint32(body))
+}
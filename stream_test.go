@@ -0,0 +1,266 @@
+package civet
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestStream(window int32, write streamWriter) *stream {
+	ctx, cancel := context.WithCancel(context.Background())
+	if write == nil {
+		write = func(MessageFlag, []byte) error { return nil }
+	}
+	return newStream(ctx, cancel, 1, GetEncoder("json"), window, write)
+}
+
+func TestStreamErr(t *testing.T) {
+	closeErr := errors.New("closed by server")
+	tests := []struct {
+		name   string
+		finish error
+		cancel bool
+		want   error
+	}{
+		{"open", nil, false, nil},
+		{"closed normally", io.EOF, false, nil},
+		{"closed by dispatch", ErrStreamClosed, false, nil},
+		{"closed with error", closeErr, false, closeErr},
+		{"window exceeded", ErrStreamWindow, false, ErrStreamWindow},
+		{"cancelled", nil, true, context.Canceled},
+		{"cancelled after close", io.EOF, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newTestStream(4, nil)
+			if tt.finish != nil {
+				st.finish(tt.finish)
+			}
+			if tt.cancel {
+				st.cancel()
+			}
+			if got := st.err(); got != tt.want {
+				t.Fatalf("err = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// streamFrames 记录流写出的帧
+type streamFrames struct {
+	mu     sync.Mutex
+	flags  []MessageFlag
+	bodies [][]byte
+}
+
+func (f *streamFrames) write(flag MessageFlag, body []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flags = append(f.flags, flag)
+	f.bodies = append(f.bodies, body)
+	return nil
+}
+
+// windows 依次返回写出的 StreamWindow 中的额度
+func (f *streamFrames) windows() []int32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var windows []int32
+	for i, flag := range f.flags {
+		if flag == MessageFlag_StreamWindow {
+			windows = append(windows, parseWindow(f.bodies[i]))
+		}
+	}
+	return windows
+}
+
+func (f *streamFrames) count(flag MessageFlag) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, fl := range f.flags {
+		if fl == flag {
+			n++
+		}
+	}
+	return n
+}
+
+func TestStreamSendCredit(t *testing.T) {
+	tests := []struct {
+		name   string
+		credit int32
+		// 额度用完后补充的额度
+		refill int32
+	}{
+		{"no credit", 0, 1},
+		{"one credit", 1, 2},
+		{"window credit", 8, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := &streamFrames{}
+			st := newTestStream(8, frames.write)
+			st.addCredit(tt.credit)
+			for i := int32(0); i < tt.credit; i++ {
+				if err := st.SendMsg(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 额度用完后 SendMsg 阻塞到对端回送 StreamWindow
+			sent := make(chan error, 1)
+			go func() {
+				sent <- st.SendMsg("blocked")
+			}()
+			select {
+			case err := <-sent:
+				t.Fatalf("send without credit returned %v", err)
+			case <-time.After(20 * time.Millisecond):
+			}
+			st.addCredit(tt.refill)
+			if err := <-sent; err != nil {
+				t.Fatal(err)
+			}
+			for i := int32(1); i < tt.refill; i++ {
+				if err := st.SendMsg(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := frames.count(MessageFlag_StreamData); got != int(tt.credit+tt.refill) {
+				t.Fatalf("sent %d data frames, want %d", got, tt.credit+tt.refill)
+			}
+		})
+	}
+}
+
+func TestStreamSendClosed(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(st *stream)
+		want  error
+	}{
+		{"finished", func(st *stream) { st.finish(io.EOF) }, ErrStreamClosed},
+		{"cancelled", func(st *stream) { st.cancel() }, context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newTestStream(4, nil)
+			sent := make(chan error, 1)
+			go func() {
+				sent <- st.SendMsg("blocked")
+			}()
+			time.Sleep(10 * time.Millisecond)
+			tt.close(st)
+			select {
+			case err := <-sent:
+				if err != tt.want {
+					t.Fatalf("err = %v, want %v", err, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("send not unblocked")
+			}
+		})
+	}
+
+	st := newTestStream(4, nil)
+	st.addCredit(4)
+	if err := st.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.SendMsg("after close"); err != ErrStreamClosed {
+		t.Fatalf("send after CloseSend = %v, want ErrStreamClosed", err)
+	}
+}
+
+func TestStreamRecvWindow(t *testing.T) {
+	tests := []struct {
+		name   string
+		window int32
+		recv   int
+		// 消费 recv 条消息后回送的 StreamWindow
+		want []int32
+	}{
+		{"below half window", 8, 3, nil},
+		{"half window", 8, 4, []int32{4}},
+		{"full window", 8, 8, []int32{4, 4}},
+		{"odd window", 5, 5, []int32{2, 2}},
+		{"window of one", 1, 3, []int32{1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := &streamFrames{}
+			st := newTestStream(tt.window, frames.write)
+			for i := 0; i < tt.recv; i++ {
+				// 每次最多有 window 条未消费的消息
+				if !st.push([]byte(`"msg"`)) {
+					t.Fatalf("push %d rejected", i)
+				}
+				var msg string
+				if err := st.RecvMsg(&msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := frames.windows()
+			if len(got) != len(tt.want) {
+				t.Fatalf("windows = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("windows = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamPushBeyondWindow(t *testing.T) {
+	st := newTestStream(2, nil)
+	if !st.push([]byte(`1`)) || !st.push([]byte(`2`)) {
+		t.Fatal("push within window rejected")
+	}
+	if st.push([]byte(`3`)) {
+		t.Fatal("push beyond window accepted")
+	}
+	var n int
+	if err := st.RecvMsg(&n); err != nil || n != 1 {
+		t.Fatalf("recv = %d, %v", n, err)
+	}
+	if !st.push([]byte(`3`)) {
+		t.Fatal("push after recv rejected")
+	}
+
+	// 结束后先读完已收到的消息，再返回结束的原因
+	st.finish(io.EOF)
+	if !st.push([]byte(`4`)) {
+		t.Fatal("push after finish reported window exceeded")
+	}
+	for _, want := range []int{2, 3} {
+		if err := st.RecvMsg(&n); err != nil || n != want {
+			t.Fatalf("recv = %d, %v, want %d", n, err, want)
+		}
+	}
+	if err := st.RecvMsg(&n); err != io.EOF {
+		t.Fatalf("recv after finish = %v, want io.EOF", err)
+	}
+}
+
+func TestWindowBody(t *testing.T) {
+	tests := []struct {
+		name string
+		body []byte
+		want int32
+	}{
+		{"round trip", windowBody(16), 16},
+		{"large", windowBody(1 << 20), 1 << 20},
+		{"empty", nil, 0},
+		{"short", []byte{1, 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := parseWindow(tt.body); got != tt.want {
+			t.Fatalf("%s: parseWindow = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package tlog
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+type DropPolicy uint8
+
+const (
+	// 队列满时丢弃新的日志
+	Drop_Newest DropPolicy = iota
+	// 队列满时丢弃队列中最旧的日志
+	Drop_Oldest
+)
+
+// ParseDropPolicy 解析 newest、oldest，空字符串为 newest
+func ParseDropPolicy(s string) DropPolicy {
+	if s == "oldest" {
+		return Drop_Oldest
+	}
+	return Drop_Newest
+}
+
+// AsyncWriter 在后台协程中写入，队列满时按 DropPolicy 丢弃日志，Write 不会阻塞
+type AsyncWriter struct {
+	w       io.Writer
+	policy  DropPolicy
+	queue   chan []byte
+	flushCh chan chan struct{}
+	dropped atomic.Uint64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	done      chan struct{}
+}
+
+func NewAsyncWriter(w io.Writer, size int, policy DropPolicy) *AsyncWriter {
+	if size <= 0 {
+		size = 1
+	}
+	aw := &AsyncWriter{
+		w:       w,
+		policy:  policy,
+		queue:   make(chan []byte, size),
+		flushCh: make(chan chan struct{}),
+		closed:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go aw.run()
+	return aw
+}
+
+// Write p 会被复制，调用方可以复用
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+	for {
+		select {
+		case aw.queue <- b:
+			return len(p), nil
+		default:
+		}
+		if aw.policy == Drop_Newest {
+			aw.dropped.Add(1)
+			return len(p), nil
+		}
+		select {
+		case <-aw.queue:
+			aw.dropped.Add(1)
+		default:
+		}
+	}
+}
+
+// Dropped 累计丢弃的日志条数
+func (aw *AsyncWriter) Dropped() uint64 {
+	return aw.dropped.Load()
+}
+
+func (aw *AsyncWriter) run() {
+	defer close(aw.done)
+	for {
+		select {
+		case b := <-aw.queue:
+			aw.w.Write(b)
+		case ack := <-aw.flushCh:
+			aw.drain()
+			if s, ok := aw.w.(interface{ Sync() error }); ok {
+				s.Sync()
+			}
+			close(ack)
+		case <-aw.closed:
+			aw.drain()
+			return
+		}
+	}
+}
+
+func (aw *AsyncWriter) drain() {
+	for {
+		select {
+		case b := <-aw.queue:
+			aw.w.Write(b)
+		default:
+			return
+		}
+	}
+}
+
+// Flush 等待队列中的日志写入
+func (aw *AsyncWriter) Flush() error {
+	ack := make(chan struct{})
+	select {
+	case aw.flushCh <- ack:
+		<-ack
+	case <-aw.done:
+	}
+	return nil
+}
+
+// Close 写入队列中剩余的日志后关闭底层的 writer
+func (aw *AsyncWriter) Close() error {
+	aw.closeOnce.Do(func() {
+		close(aw.closed)
+	})
+	<-aw.done
+	if c, ok := aw.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package tlog
+
+import (
+	"context"
+	"github.com/YCloud/civet/meta"
+	"github.com/YCloud/civet/trace"
+	"sync/atomic"
+)
+
+type loggerKey struct{}
+
+// With 返回保存了子 Logger 的 ctx，之后使用该 ctx 的 *c 函数都会带上 fields
+func With(ctx context.Context, fields ...*Field) context.Context {
+	return context.WithValue(ctx, loggerKey{}, FromContext(ctx).With(fields...))
+}
+
+// FromContext ctx 中由 With 保存的 Logger，没有时返回 Default
+func FromContext(ctx context.Context) Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(loggerKey{}).(Logger); ok {
+			return l
+		}
+	}
+	return Default()
+}
+
+var contextHeaders atomic.Pointer[[]string]
+
+// SetContextHeaders 设置需要输出到日志中的请求 header，key 与 meta 中的相同
+func SetContextHeaders(keys ...string) {
+	keys = append([]string(nil), keys...)
+	contextHeaders.Store(&keys)
+}
+
+// contextFields 从 ctx 中取出 trace_id、span_id、route、caller 与 SetContextHeaders 设置的 header
+func contextFields(ctx context.Context) []*Field {
+	if ctx == nil {
+		return nil
+	}
+	var fields []*Field
+	if span := trace.SpanFromContext(ctx); span != nil {
+		fields = append(fields, Any("trace_id", span.TraceID), Any("span_id", span.SpanID))
+	}
+	if route, ok := meta.RouteFromContext(ctx); ok {
+		fields = append(fields, Any("route", route))
+	}
+	header, ok := meta.FromMetaContextReqContext(ctx)
+	if !ok {
+		return fields
+	}
+	if caller := header[meta.Caller]; caller != "" {
+		fields = append(fields, Any("caller", caller))
+	}
+	if keys := contextHeaders.Load(); keys != nil {
+		for _, k := range *keys {
+			if v, ok := header[k]; ok {
+				fields = append(fields, Any(k, v))
+			}
+		}
+	}
+	return fields
+}
@@ -0,0 +1,114 @@
+package tlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Encoder 将一条日志编码为一行，写入 buf，包含结尾的换行
+type Encoder interface {
+	Encode(buf *bytes.Buffer, entry *Entry)
+}
+
+type textEncoder struct {
+	timeFormat TimeFormat
+}
+
+// NewTextEncoder 输出 "时间|级别|k=v|...|消息|k=v k=v"，Logger 的 fields 在消息前，调用时的 fields 在消息后，
+// 值中含有分隔符或空白时按 Go 字符串字面量加引号
+func NewTextEncoder(timeFormat TimeFormat) Encoder {
+	if timeFormat == nil {
+		timeFormat = defaultTimeFormat
+	}
+	return &textEncoder{timeFormat: timeFormat}
+}
+
+func (e *textEncoder) Encode(buf *bytes.Buffer, entry *Entry) {
+	buf.WriteString(e.timeFormat(entry.Time))
+	buf.WriteByte('|')
+	buf.WriteString(entry.Level.String())
+	buf.WriteByte('|')
+	for _, f := range entry.LoggerFields {
+		writeTextField(buf, f)
+		buf.WriteByte('|')
+	}
+	buf.WriteString(entry.Msg)
+	for i, f := range entry.Fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte('|')
+		}
+		writeTextField(buf, f)
+	}
+	buf.WriteByte('\n')
+}
+
+// writeTextField 值中含有分隔符、引号、空白或控制字符时加引号并转义，
+// 避免来自请求的值（如 caller 与请求头）伪造日志行或字段
+func writeTextField(buf *bytes.Buffer, f *Field) {
+	buf.WriteString(f.Key)
+	buf.WriteByte('=')
+	v := fmt.Sprintf("%+v", f.Value)
+	if needQuote(v) {
+		v = strconv.Quote(v)
+	}
+	buf.WriteString(v)
+}
+
+func needQuote(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '|' || r == '"' || r == 0x7f
+	}) >= 0
+}
+
+type jsonEncoder struct {
+	timeFormat TimeFormat
+}
+
+// NewJSONEncoder 每条日志输出一个 json 对象，包含 time、level、msg 与所有 fields
+func NewJSONEncoder(timeFormat TimeFormat) Encoder {
+	if timeFormat == nil {
+		timeFormat = defaultTimeFormat
+	}
+	return &jsonEncoder{timeFormat: timeFormat}
+}
+
+func (e *jsonEncoder) Encode(buf *bytes.Buffer, entry *Entry) {
+	buf.WriteString(`{"time":`)
+	writeJSONValue(buf, e.timeFormat(entry.Time))
+	buf.WriteString(`,"level":`)
+	writeJSONValue(buf, entry.Level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSONValue(buf, entry.Msg)
+	writeJSONFields(buf, entry.LoggerFields)
+	writeJSONFields(buf, entry.Fields)
+	buf.WriteString("}\n")
+}
+
+func writeJSONFields(buf *bytes.Buffer, fields []*Field) {
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSONValue(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSONValue(buf, f.Value)
+	}
+}
+
+// writeJSONValue error 与 fmt.Stringer 输出为字符串，无法编码的值使用 %+v
+func writeJSONValue(buf *bytes.Buffer, v any) {
+	switch val := v.(type) {
+	case error:
+		v = val.Error()
+	case fmt.Stringer:
+		v = val.String()
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		bs, _ = json.Marshal(fmt.Sprintf("%+v", v))
+	}
+	buf.Write(bs)
+}
@@ -1,10 +1,14 @@
 package tlog
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,6 +21,22 @@ const (
 	ERROR Level = 4
 )
 
+// ParseLevel 解析 debug、info、warn、error，不区分大小写
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DEBUG, nil
+	case "info":
+		return INFO, nil
+	case "warn":
+		return WARN, nil
+	case "error":
+		return ERROR, nil
+	default:
+		return 0, fmt.Errorf("unknown log level %s", s)
+	}
+}
+
 func (l Level) String() string {
 	switch l {
 	case DEBUG:
@@ -32,7 +52,17 @@ func (l Level) String() string {
 	}
 }
 
+// Logger 日志输出，实现需要支持并发调用
 type Logger interface {
+	// Log 除 fields 外，还会输出 ctx 中的 trace_id、span_id、route、caller 与 SetContextHeaders 设置的 header
+	Log(ctx context.Context, lv Level, msg string, fields ...*Field)
+	Enabled(lv Level) bool
+	SetLevel(lv Level)
+	Level() Level
+	// With 返回附加了 fields 的子 Logger，与父 Logger 共用级别与输出
+	With(fields ...*Field) Logger
+	// Flush 将缓冲中的日志写入输出
+	Flush() error
 }
 
 type Field struct {
@@ -48,6 +78,158 @@ func Any(k string, v any) *Field {
 	return &Field{Key: k, Value: v}
 }
 
+// Entry 一条日志
+type Entry struct {
+	Time  time.Time
+	Level Level
+	Msg   string
+	// Logger 的 fields 与从 ctx 中取出的 trace_id、route 等
+	LoggerFields []*Field
+	// 调用时传入的 fields
+	Fields []*Field
+}
+
+type TimeFormat func(t time.Time) string
+
+func defaultTimeFormat(t time.Time) string {
+	return t.Format("2006-01-02 15:04:05.000")
+}
+
+type Option func(l *logger)
+
+func WithEncoder(enc Encoder) Option {
+	return func(l *logger) {
+		l.encoder = enc
+	}
+}
+
+// WithWriter 日志的输出，不阻塞请求时使用 NewAsyncWriter 包装
+func WithWriter(w io.Writer) Option {
+	return func(l *logger) {
+		l.writer = w
+	}
+}
+
+func WithLevel(lv Level) Option {
+	return func(l *logger) {
+		l.level.Store(uint32(lv))
+	}
+}
+
+func WithFields(fields ...*Field) Option {
+	return func(l *logger) {
+		l.fields = append(l.fields, fields...)
+	}
+}
+
+type logger struct {
+	level   *atomic.Uint32
+	encoder Encoder
+	writer  io.Writer
+	fields  []*Field
+}
+
+var bufPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+// NewLogger 默认以文本格式输出到标准输出，级别为 DEBUG
+func NewLogger(opts ...Option) Logger {
+	l := &logger{
+		level:   &atomic.Uint32{},
+		encoder: NewTextEncoder(defaultTimeFormat),
+		writer:  os.Stdout,
+		fields:  make([]*Field, 0),
+	}
+	l.level.Store(uint32(DEBUG))
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+func (l *logger) Log(ctx context.Context, lv Level, msg string, fields ...*Field) {
+	if !l.Enabled(lv) {
+		return
+	}
+	loggerFields := l.fields
+	if ctxFields := contextFields(ctx); len(ctxFields) > 0 {
+		loggerFields = append(loggerFields[:len(loggerFields):len(loggerFields)], ctxFields...)
+	}
+	entry := &Entry{
+		Time:         time.Now(),
+		Level:        lv,
+		Msg:          msg,
+		LoggerFields: loggerFields,
+		Fields:       fields,
+	}
+
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	l.encoder.Encode(buf, entry)
+	l.writer.Write(buf.Bytes())
+	bufPool.Put(buf)
+}
+
+func (l *logger) Enabled(lv Level) bool {
+	return uint32(lv) >= l.level.Load()
+}
+
+func (l *logger) SetLevel(lv Level) {
+	l.level.Store(uint32(lv))
+}
+
+func (l *logger) Level() Level {
+	return Level(l.level.Load())
+}
+
+func (l *logger) With(fields ...*Field) Logger {
+	child := *l
+	child.fields = make([]*Field, 0, len(l.fields)+len(fields))
+	child.fields = append(child.fields, l.fields...)
+	child.fields = append(child.fields, fields...)
+	return &child
+}
+
+func (l *logger) Flush() error {
+	switch w := l.writer.(type) {
+	case interface{ Flush() error }:
+		return w.Flush()
+	case interface{ Sync() error }:
+		return w.Sync()
+	}
+	return nil
+}
+
+var log atomic.Pointer[Logger]
+
+func init() {
+	SetLogger(NewLogger(WithFields(Any("pid", os.Getpid()))))
+}
+
+// SetLogger 替换包级别函数使用的 Logger，之前的 Logger 会先 Flush
+func SetLogger(l Logger) {
+	if old := log.Swap(&l); old != nil {
+		(*old).Flush()
+	}
+}
+
+// Default 包级别函数使用的 Logger
+func Default() Logger {
+	return *log.Load()
+}
+
+// SetLevel 修改日志级别，低于该级别的日志不输出
+func SetLevel(lv Level) {
+	Default().SetLevel(lv)
+}
+
+func GetLevel() Level {
+	return Default().Level()
+}
+
 func Debug(msg string, fields ...*Field) {
 	write(context.TODO(), DEBUG, msg, fields...)
 }
@@ -80,53 +262,12 @@ func Errorc(ctx context.Context, msg string, fields ...*Field) {
 	write(ctx, ERROR, msg, fields...)
 }
 
+// Flush 进程退出前调用，将缓冲中的日志写入输出
 func Flush() {
-	log.writer.Close()
+	Default().Flush()
 }
 
+// write ctx 中有 With 保存的 Logger 时使用该 Logger
 func write(ctx context.Context, lv Level, msg string, fields ...*Field) {
-	if log.level > lv {
-		return
-	}
-	s := fmt.Sprintf(defaultLogLayout, log.timeFormat(time.Now()), lv)
-	for _, f := range log.fields {
-		s = s + f.String() + "|"
-	}
-	s = s + msg
-	for i, f := range fields {
-		if i > 0 {
-			s = s + " "
-		} else {
-			s = s + "|"
-		}
-		s = s + f.String()
-	}
-	log.writer.Write([]byte(s + "\n"))
-}
-
-type TimeFormat func(t time.Time) string
-
-func defaultTimeFormat(t time.Time) string {
-	return t.Format("2006-01-02 15:04:05.000")
-}
-
-type logger struct {
-	timeFormat TimeFormat
-	fields     []*Field
-	level      Level
-	writer     io.WriteCloser
-}
-
-var log *logger
-
-const defaultLogLayout = "%s|%s|"
-
-func init() {
-	log = &logger{
-		timeFormat: defaultTimeFormat,
-		fields:     make([]*Field, 0),
-		level:      DEBUG,
-		writer:     os.Stdout,
-	}
-	log.fields = append(log.fields, Any("pid", os.Getpid()))
+	FromContext(ctx).Log(ctx, lv, msg, fields...)
 }
@@ -0,0 +1,199 @@
+package tlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateRetryInterval 切分失败后继续写入当前文件，间隔一段时间再重试
+const rotateRetryInterval = 10 * time.Second
+
+type RotateInterval uint8
+
+const (
+	// 只按大小切分
+	Rotate_None RotateInterval = iota
+	Rotate_Hourly
+	Rotate_Daily
+)
+
+// ParseRotateInterval 解析 hourly、daily，空字符串表示只按大小切分
+func ParseRotateInterval(s string) (RotateInterval, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return Rotate_None, nil
+	case "hourly":
+		return Rotate_Hourly, nil
+	case "daily":
+		return Rotate_Daily, nil
+	default:
+		return Rotate_None, fmt.Errorf("unknown rotate interval %s", s)
+	}
+}
+
+type RotateConfig struct {
+	Dir  string
+	Name string
+	// 单个文件的最大字节数，0 表示不按大小切分
+	MaxSize int64
+	// 保留的历史文件个数，0 表示不限制
+	MaxBackups int
+	// 历史文件保留的时间，0 表示不限制
+	MaxAge   time.Duration
+	Interval RotateInterval
+}
+
+// RotateWriter 写入 Dir/Name，按大小或时间切分，历史文件重命名为 Name.20060102-150405
+type RotateWriter struct {
+	cfg    RotateConfig
+	path   string
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time
+	// 切分失败后下次重试的时间
+	retryAt time.Time
+}
+
+func NewRotateWriter(cfg RotateConfig) (*RotateWriter, error) {
+	if cfg.Dir == "" {
+		cfg.Dir = "."
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	w := &RotateWriter{cfg: cfg, path: filepath.Join(cfg.Dir, cfg.Name)}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// periodOf 时间所在切分周期的开始
+func (w *RotateWriter) periodOf(t time.Time) time.Time {
+	switch w.cfg.Interval {
+	case Rotate_Hourly:
+		return t.Truncate(time.Hour)
+	case Rotate_Daily:
+		y, m, d := t.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Time{}
+	}
+}
+
+func (w *RotateWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	// 已有的文件按最后修改时间计算周期，进程重启后仍能按时切分
+	w.period = w.periodOf(info.ModTime())
+	if w.size == 0 {
+		w.period = w.periodOf(time.Now())
+	}
+	return nil
+}
+
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return 0, os.ErrClosed
+	}
+	now := time.Now()
+	if w.size > 0 && !now.Before(w.retryAt) && ((w.cfg.MaxSize > 0 && w.size+int64(len(p)) > w.cfg.MaxSize) ||
+		(w.cfg.Interval != Rotate_None && !w.periodOf(now).Equal(w.period))) {
+		if err := w.rotate(now); err != nil {
+			w.retryAt = now.Add(rotateRetryInterval)
+			fmt.Fprintf(os.Stderr, "tlog: rotate %s failed: %v\n", w.path, err)
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate 失败时保留当前文件继续写入；重命名成功但打开新文件失败时写入已重命名的文件，重试时只重新打开
+func (w *RotateWriter) rotate(now time.Time) error {
+	backup := w.path + "." + now.Format("20060102-150405")
+	for i := 1; ; i++ {
+		if _, err := os.Stat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s.%s.%d", w.path, now.Format("20060102-150405"), i)
+	}
+	if err := os.Rename(w.path, backup); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	old := w.file
+	if err := w.open(); err != nil {
+		return err
+	}
+	old.Close()
+	go w.cleanup()
+	return nil
+}
+
+// cleanup 删除超过个数或保留时间的历史文件
+func (w *RotateWriter) cleanup() {
+	if w.cfg.MaxBackups <= 0 && w.cfg.MaxAge <= 0 {
+		return
+	}
+	matches, err := filepath.Glob(w.path + ".*")
+	if err != nil {
+		return
+	}
+	type backup struct {
+		path    string
+		modTime time.Time
+	}
+	backups := make([]backup, 0, len(matches))
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		backups = append(backups, backup{path: path, modTime: info.ModTime()})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].modTime.After(backups[j].modTime)
+	})
+	for i, b := range backups {
+		if (w.cfg.MaxBackups > 0 && i >= w.cfg.MaxBackups) || (w.cfg.MaxAge > 0 && time.Since(b.modTime) > w.cfg.MaxAge) {
+			os.Remove(b.path)
+		}
+	}
+}
+
+func (w *RotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,269 @@
+package civet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/YCloud/civet/internal/config"
+	"github.com/YCloud/civet/tlog"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const tlsHandshakeTimeout = 10 * time.Second
+
+// tlsReloader 持有当前的证书与 CA，距上次检查超过 ReloadInterval 时比较文件修改时间，修改后重新加载。
+// 重新加载失败时继续使用原证书
+type tlsReloader struct {
+	cfg        *config.TLSConf
+	minVersion uint16
+	clientAuth tls.ClientAuthType
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	modTimes  []time.Time
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+	serverCfg *tls.Config
+}
+
+func newTLSReloader(cfg *config.TLSConf) (*tlsReloader, error) {
+	minVersion, err := parseTLSVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := parseClientAuth(cfg.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	r := &tlsReloader{
+		cfg:        cfg,
+		minVersion: minVersion,
+		clientAuth: clientAuth,
+	}
+	if err = r.load(); err != nil {
+		return nil, err
+	}
+	r.modTimes = r.statFiles()
+	r.checkedAt = time.Now()
+	return r, nil
+}
+
+func parseTLSVersion(s string) (uint16, error) {
+	switch s {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown tls version %s", s)
+	}
+}
+
+func parseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "none":
+		return tls.NoClientCert, nil
+	case "request":
+		return tls.RequestClientCert, nil
+	case "require":
+		return tls.RequireAnyClientCert, nil
+	case "verify":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require_and_verify":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unknown tls client auth %s", s)
+	}
+}
+
+func (r *tlsReloader) files() []string {
+	return []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile}
+}
+
+// statFiles 文件不存在或未配置时修改时间为零值
+func (r *tlsReloader) statFiles() []time.Time {
+	files := r.files()
+	modTimes := make([]time.Time, len(files))
+	for i, file := range files {
+		if file == "" {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			modTimes[i] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func (r *tlsReloader) load() error {
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" || r.cfg.KeyFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in %s", r.cfg.CAFile)
+		}
+	}
+
+	var serverCfg *tls.Config
+	if cert != nil {
+		serverCfg = &tls.Config{
+			Certificates: []tls.Certificate{*cert},
+			ClientCAs:    pool,
+			ClientAuth:   r.clientAuth,
+			MinVersion:   r.minVersion,
+		}
+	}
+	r.mu.Lock()
+	r.cert, r.pool, r.serverCfg = cert, pool, serverCfg
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *tlsReloader) maybeReload() {
+	r.mu.Lock()
+	if time.Since(r.checkedAt) < r.cfg.ReloadInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.checkedAt = time.Now()
+	prev := r.modTimes
+	r.mu.Unlock()
+
+	modTimes := r.statFiles()
+	changed := false
+	for i, t := range modTimes {
+		if !t.Equal(prev[i]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := r.load(); err != nil {
+		tlog.Error("reload tls certificate failed", tlog.Any("cert", r.cfg.CertFile), tlog.Any("err", err))
+		return
+	}
+	r.mu.Lock()
+	r.modTimes = modTimes
+	r.mu.Unlock()
+	tlog.Info("tls certificate reloaded", tlog.Any("cert", r.cfg.CertFile))
+}
+
+// listenerConfig 每个新连接通过 GetConfigForClient 取得当前的证书
+func (r *tlsReloader) listenerConfig() (*tls.Config, error) {
+	if r.serverCfg == nil {
+		return nil, fmt.Errorf("tls certFile and keyFile are required for servant")
+	}
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.maybeReload()
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			return r.serverCfg, nil
+		},
+	}, nil
+}
+
+// clientConfig 连接 addr 使用的配置，ServerName 为空时使用 addr 中的 host
+func (r *tlsReloader) clientConfig(addr string) *tls.Config {
+	r.maybeReload()
+	serverName := r.cfg.ServerName
+	if serverName == "" {
+		serverName, _, _ = net.SplitHostPort(addr)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cfg := &tls.Config{
+		ServerName:         serverName,
+		RootCAs:            r.pool,
+		MinVersion:         r.minVersion,
+		InsecureSkipVerify: r.cfg.InsecureSkipVerify,
+	}
+	if r.cert != nil {
+		cfg.Certificates = []tls.Certificate{*r.cert}
+	}
+	return cfg
+}
+
+// newTLSListener 未配置 TLS 时返回原 listener
+func newTLSListener(lis net.Listener, cfg *config.TLSConf) (net.Listener, error) {
+	if cfg == nil {
+		return lis, nil
+	}
+	r, err := newTLSReloader(cfg)
+	if err != nil {
+		return nil, err
+	}
+	tlsCfg, err := r.listenerConfig()
+	if err != nil {
+		return nil, err
+	}
+	return tls.NewListener(lis, tlsCfg), nil
+}
+
+// handshake 在读写之前完成 TLS 握手，非 TLS 连接直接返回
+func handshake(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tlsHandshakeTimeout)
+	defer cancel()
+	return tlsConn.HandshakeContext(ctx)
+}
+
+// Peer 请求的对端
+type Peer struct {
+	Addr string
+	// 开启 TLS 时为连接的状态，否则为 nil
+	TLS *tls.ConnectionState
+}
+
+// Certificate 对端提供的证书，未开启 TLS 或对端没有提供证书时返回 nil
+func (p *Peer) Certificate() *x509.Certificate {
+	if p.TLS == nil || len(p.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return p.TLS.PeerCertificates[0]
+}
+
+type peerKey struct{}
+
+func newPeerContext(ctx context.Context, peer *Peer) context.Context {
+	return context.WithValue(ctx, peerKey{}, peer)
+}
+
+// PeerFromContext 取出 servant 处理请求时对端的地址与证书，拦截器中可用于身份校验
+func PeerFromContext(ctx context.Context) (*Peer, bool) {
+	peer, ok := ctx.Value(peerKey{}).(*Peer)
+	return peer, ok
+}
+
+func newPeer(conn net.Conn) *Peer {
+	peer := &Peer{Addr: conn.RemoteAddr().String()}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		peer.TLS = &state
+	}
+	return peer
+}
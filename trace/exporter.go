@@ -0,0 +1,173 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpanExporter 导出已结束的 span，ExportSpans 在后台协程中批量调用
+type SpanExporter interface {
+	ExportSpans(ctx context.Context, spans []*Span) error
+	Shutdown(ctx context.Context) error
+}
+
+const (
+	queueSize     = 2048
+	batchSize     = 256
+	flushInterval = time.Second
+	exportTimeout = 10 * time.Second
+)
+
+var current atomic.Pointer[batcher]
+
+// SetExporter 设置 span 的导出，替换之前的 exporter 并将其关闭；exporter 为 nil 时只传递 trace 不导出
+func SetExporter(exporter SpanExporter) {
+	var b *batcher
+	if exporter != nil {
+		b = newBatcher(exporter)
+	}
+	if old := current.Swap(b); old != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		defer cancel()
+		old.shutdown(ctx)
+	}
+}
+
+// Shutdown 导出队列中剩余的 span 并关闭 exporter
+func Shutdown(ctx context.Context) error {
+	if b := current.Swap(nil); b != nil {
+		return b.shutdown(ctx)
+	}
+	return nil
+}
+
+func export(span *Span) {
+	if b := current.Load(); b != nil {
+		b.add(span)
+	}
+}
+
+// batcher 队列满时丢弃 span，不阻塞请求
+type batcher struct {
+	exporter SpanExporter
+	queue    chan *Span
+	closed   chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newBatcher(exporter SpanExporter) *batcher {
+	b := &batcher{
+		exporter: exporter,
+		queue:    make(chan *Span, queueSize),
+		closed:   make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(span *Span) {
+	select {
+	case b.queue <- span:
+	default:
+	}
+}
+
+func (b *batcher) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		b.exporter.ExportSpans(ctx, batch)
+		cancel()
+		batch = make([]*Span, 0, batchSize)
+	}
+	for {
+		select {
+		case span := <-b.queue:
+			batch = append(batch, span)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-b.closed:
+			for {
+				select {
+				case span := <-b.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *batcher) shutdown(ctx context.Context) error {
+	b.once.Do(func() {
+		close(b.closed)
+	})
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return b.exporter.Shutdown(ctx)
+}
+
+// writerExporter 每个 span 输出一行 json
+type writerExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter 将 span 以 json 行写入 w
+func NewWriterExporter(w io.Writer) SpanExporter {
+	return &writerExporter{w: w}
+}
+
+// NewStdoutExporter 将 span 以 json 行输出到标准输出
+func NewStdoutExporter() SpanExporter {
+	return NewWriterExporter(os.Stdout)
+}
+
+// NewFileExporter 将 span 以 json 行追加到文件
+func NewFileExporter(path string) (SpanExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterExporter(file), nil
+}
+
+func (e *writerExporter) ExportSpans(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, span := range spans {
+		if err := enc.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *writerExporter) Shutdown(ctx context.Context) error {
+	if f, ok := e.w.(*os.File); ok && f != os.Stdout && f != os.Stderr {
+		return f.Close()
+	}
+	return nil
+}
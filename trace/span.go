@@ -0,0 +1,213 @@
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID W3C trace-context 中的 trace-id，16 字节
+type TraceID [16]byte
+
+// SpanID W3C trace-context 中的 parent-id，8 字节
+type SpanID [8]byte
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (t TraceID) MarshalText() ([]byte, error) {
+	if !t.IsValid() {
+		return []byte{}, nil
+	}
+	return []byte(t.String()), nil
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s SpanID) MarshalText() ([]byte, error) {
+	if !s.IsValid() {
+		return []byte{}, nil
+	}
+	return []byte(s.String()), nil
+}
+
+const flagSampled = 0x01
+
+// SpanContext 跨进程传递的部分，对应 traceparent 与 tracestate
+type SpanContext struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&flagSampled != 0
+}
+
+// Traceparent 格式为 00-{trace-id}-{parent-id}-{flags}
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, sc.Flags)
+}
+
+// ParseTraceparent 解析 traceparent，格式不正确时返回 false；未知版本只取前四个字段
+func ParseTraceparent(traceparent, tracestate string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Flags = flags[0]
+	sc.TraceState = strings.TrimSpace(tracestate)
+	return sc, sc.IsValid()
+}
+
+type SpanKind uint8
+
+const (
+	SpanKind_Server SpanKind = 1 + iota
+	SpanKind_Client
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case SpanKind_Server:
+		return "server"
+	case SpanKind_Client:
+		return "client"
+	default:
+		return fmt.Sprintf("kind(%d)", k)
+	}
+}
+
+func (k SpanKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// Span 一次请求在一个进程内的处理，End 后交给 SpanExporter
+type Span struct {
+	Name         string            `json:"name"`
+	Kind         SpanKind          `json:"kind"`
+	TraceID      TraceID           `json:"traceId"`
+	SpanID       SpanID            `json:"spanId"`
+	ParentSpanID SpanID            `json:"parentSpanId"`
+	TraceState   string            `json:"traceState,omitempty"`
+	StartTime    time.Time         `json:"startTime"`
+	EndTime      time.Time         `json:"endTime"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	Error        string            `json:"error,omitempty"`
+
+	flags   byte
+	mu      sync.Mutex
+	endOnce sync.Once
+}
+
+// SpanContext 传给下游的 SpanContext，parent-id 为当前 span
+func (s *Span) SpanContext() SpanContext {
+	return SpanContext{
+		TraceID:    s.TraceID,
+		SpanID:     s.SpanID,
+		Flags:      s.flags,
+		TraceState: s.TraceState,
+	}
+}
+
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]string)
+	}
+	s.Attributes[key] = value
+}
+
+// End 结束 span，err 不为 nil 时记录为失败；重复调用只有第一次生效
+func (s *Span) End(err error) {
+	s.endOnce.Do(func() {
+		s.mu.Lock()
+		s.EndTime = time.Now()
+		if err != nil {
+			s.Error = err.Error()
+		}
+		s.mu.Unlock()
+		if s.flags&flagSampled != 0 {
+			export(s)
+		}
+	})
+}
+
+type spanKey struct{}
+
+type remoteKey struct{}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext 保存从请求中解析出的上游 SpanContext，作为 Start 的父节点
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// Start 创建 span 并放入返回的 ctx；ctx 中的 span 或上游 SpanContext 作为父节点，都没有时开始新的 trace
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	span := &Span{
+		Name:      name,
+		Kind:      kind,
+		StartTime: time.Now(),
+	}
+	var parent SpanContext
+	if p := SpanFromContext(ctx); p != nil {
+		parent = p.SpanContext()
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		parent = remote
+	}
+	if parent.IsValid() {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+		span.TraceState = parent.TraceState
+		span.flags = parent.Flags
+	} else {
+		rand.Read(span.TraceID[:])
+		span.flags = flagSampled
+	}
+	rand.Read(span.SpanID[:])
+	return ContextWithSpan(ctx, span), span
+}